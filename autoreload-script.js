@@ -1,4 +0,0 @@
-HMR.onCurrentPageChange(() => {
-  console.log("Current page changed, reloading...");
-  location.reload();
-});
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/ncpa0cpl/static-server/utils"
+)
+
+// hmrEndpointUrl returns the WebSocket URL of the HMR endpoint of
+// the server at the given address, e.g. `localhost:8080` or
+// `https://example.com/app`.
+func hmrEndpointUrl(address string) (string, error) {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", err
+	}
+
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("unsupported scheme: %s", u.Scheme)
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/__serve_hmr"
+	u.RawQuery = fmt.Sprintf("v=%d", utils.HmrProtocolVersion)
+	return u.String(), nil
+}
+
+// runEvents implements the `events` subcommand, which connects to
+// a running server and prints the HMR messages as JSON lines.
+func runEvents(argv []string) int {
+	args := utils.ParseArgs(argv, []string{
+		"--help",
+		"--once",
+	})
+
+	if args.NamedParams.Has("help") {
+		fmt.Println("Usage: goserve events [options] [address]")
+		fmt.Println("")
+		fmt.Println("Connects to a server running with '--watch' and prints the events as JSON lines.")
+		fmt.Println("The events of a batch are printed one per line. Default address: localhost:8080")
+		fmt.Println("")
+		fmt.Println("Options:")
+		fmt.Println("  --help              Print this help message.")
+		fmt.Println("  --once              Exit after the first file change, or batch of changes.")
+		fmt.Println("  --include <glob>    Only print the file events for paths matching the pattern. Can be repeated.")
+		fmt.Println("")
+		fmt.Println("Exits with 0 when the server shuts down, and with 1 when the connection fails or is lost.")
+		return ExitOk
+	}
+
+	address := args.Input
+	if address == "" {
+		address = "localhost:8080"
+	}
+
+	endpoint, err := hmrEndpointUrl(address)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid server address: %s\n", err.Error())
+		return ExitError
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(endpoint, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to connect to %s: %s\n", endpoint, err.Error())
+		return ExitError
+	}
+	defer conn.Close()
+
+	if patterns := args.GetParamList("include"); len(patterns) > 0 {
+		err = conn.WriteJSON(&utils.HmrClientMessage{
+			Type:     utils.HmrClientSubscribe,
+			Patterns: patterns,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to subscribe: %s\n", err.Error())
+			return ExitError
+		}
+	}
+
+	once := args.NamedParams.Has("once")
+	out := json.NewEncoder(os.Stdout)
+
+	for {
+		msg := &utils.HmrMessage{}
+		// pings are answered by the default handler while reading
+		if err := conn.ReadJSON(msg); err != nil {
+			// the server sends a close frame when it shuts down
+			if websocket.IsCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				fmt.Fprintln(os.Stderr, "The server closed the connection")
+				return ExitOk
+			}
+			fmt.Fprintf(os.Stderr, "Connection lost: %s\n", err.Error())
+			return ExitError
+		}
+
+		switch msg.Type {
+		case utils.HmrConnected:
+			continue
+		case utils.HmrBatch:
+			for _, event := range msg.Events {
+				out.Encode(event)
+			}
+		default:
+			out.Encode(msg)
+		}
+
+		if once && (msg.Type == utils.HmrBatch || msg.IsFileEvent()) {
+			return ExitOk
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package goserve
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	AccessLogCommon   = "common"
+	AccessLogCombined = "combined"
+	AccessLogJSON     = "json"
+)
+
+// Keys under which the file handlers store additional information
+// about the response in the echo.Context, read by the access logger.
+const (
+	ctxCacheStatus = "serve:cache"
+	ctxRange       = "serve:range"
+)
+
+type AccessLogEntry struct {
+	Time      time.Time `json:"time"`
+	Remote    string    `json:"remote"`
+	Method    string    `json:"method"`
+	Uri       string    `json:"uri"`
+	Proto     string    `json:"proto"`
+	Status    int       `json:"status"`
+	Bytes     int64     `json:"bytes"`
+	LatencyMs float64   `json:"latency_ms"`
+	Referer   string    `json:"referer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Cache     string    `json:"cache,omitempty"`
+	Range     string    `json:"range,omitempty"`
+	Encoding  string    `json:"encoding"`
+}
+
+type AccessLogger struct {
+	format string
+	out    io.Writer
+	mutex  *sync.Mutex
+}
+
+func CreateAccessLogger(format string, out io.Writer) (*AccessLogger, error) {
+	switch format {
+	case AccessLogCommon, AccessLogCombined, AccessLogJSON:
+	default:
+		return nil, fmt.Errorf("unknown access log format: %s", format)
+	}
+
+	return &AccessLogger{
+		format: format,
+		out:    out,
+		mutex:  &sync.Mutex{},
+	}, nil
+}
+
+func (l *AccessLogger) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+
+			err := next(c)
+			if err != nil {
+				// let the error handler write the response,
+				// so that the logged status is the one that was sent
+				c.Error(err)
+			}
+
+			req := c.Request()
+			res := c.Response()
+
+			entry := &AccessLogEntry{
+				Time:      start,
+				Remote:    c.RealIP(),
+				Method:    req.Method,
+				Uri:       req.RequestURI,
+				Proto:     req.Proto,
+				Status:    res.Status,
+				Bytes:     res.Size,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+				Referer:   req.Referer(),
+				UserAgent: req.UserAgent(),
+				Encoding:  res.Header().Get("Content-Encoding"),
+			}
+
+			if entry.Encoding == "" {
+				entry.Encoding = "identity"
+			}
+			// a successful WebSocket handshake hijacks the connection,
+			// the response is written by the upgrader, bypassing echo
+			if !res.Committed && strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+				entry.Status = http.StatusSwitchingProtocols
+			}
+			if v, ok := c.Get(ctxCacheStatus).(string); ok {
+				entry.Cache = v
+			}
+			if v, ok := c.Get(ctxRange).(string); ok {
+				entry.Range = v
+			}
+
+			l.Write(entry)
+
+			return nil
+		}
+	}
+}
+
+func (l *AccessLogger) Write(entry *AccessLogEntry) {
+	var line string
+
+	switch l.format {
+	case AccessLogJSON:
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+		line = string(b) + "\n"
+	default:
+		line = l.formatCommon(entry)
+	}
+
+	l.mutex.Lock()
+	io.WriteString(l.out, line)
+	l.mutex.Unlock()
+}
+
+func (l *AccessLogger) formatCommon(entry *AccessLogEntry) string {
+	bytesSent := "-"
+	if entry.Bytes > 0 {
+		bytesSent = strconv.FormatInt(entry.Bytes, 10)
+	}
+
+	b := &strings.Builder{}
+	fmt.Fprintf(
+		b, "%s - - [%s] \"%s %s %s\" %d %s",
+		entry.Remote,
+		entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		entry.Method, entry.Uri, entry.Proto,
+		entry.Status, bytesSent,
+	)
+
+	if l.format == AccessLogCombined {
+		fmt.Fprintf(b, " %s %s", quoteOrDash(entry.Referer), quoteOrDash(entry.UserAgent))
+	}
+
+	// goserve specific fields are appended after the standard ones
+	// so that the line prefix stays parseable by the usual tools
+	cache := entry.Cache
+	if cache == "" {
+		cache = "-"
+	}
+	rng := entry.Range
+	if rng == "" {
+		rng = "-"
+	}
+	fmt.Fprintf(
+		b, " cache=%s range=%s enc=%s latency=%.3fms\n",
+		cache, rng, entry.Encoding, entry.LatencyMs,
+	)
+
+	return b.String()
+}
+
+func quoteOrDash(s string) string {
+	if s == "" {
+		return "\"-\""
+	}
+	return strconv.Quote(s)
+}
@@ -0,0 +1,171 @@
+package goserve
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncpa0cpl/static-server/utils"
+)
+
+type CachedFileInfo struct {
+	// url prefix the file's directory is mounted under
+	Mount        string    `json:"mount"`
+	Path         string    `json:"path"`
+	RelPath      string    `json:"relPath"`
+	Size         int       `json:"size"`
+	ContentType  string    `json:"contentType"`
+	Etag         string    `json:"etag"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+type BroadcastRequest struct {
+	Message string `json:"message"`
+	// sends the message only to the selected clients if set
+	Target *utils.ClientTarget `json:"target"`
+}
+
+func GenerateAdminToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func adminAuth(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if token == "" {
+				return next(c)
+			}
+
+			auth := c.Request().Header.Get("Authorization")
+			given := strings.TrimPrefix(auth, "Bearer ")
+			if auth == given || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				return c.JSON(401, map[string]string{"error": "unauthorized"})
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// findMount returns the file routes serving the given url path, along
+// with the path of the file relative to their root directory.
+func findMount(mounts []*FileRoutes, urlPath string) (*FileRoutes, string) {
+	urlPath = "/" + strings.TrimPrefix(urlPath, "/")
+
+	var found *FileRoutes
+	for _, routes := range mounts {
+		if routes.BaseUrl != "" && !strings.HasPrefix(urlPath, routes.BaseUrl+"/") {
+			continue
+		}
+		// the longest prefix wins
+		if found == nil || len(routes.BaseUrl) > len(found.BaseUrl) {
+			found = routes
+		}
+	}
+	if found == nil {
+		return nil, ""
+	}
+	return found, urlPath[len(found.BaseUrl)+1:]
+}
+
+// AddAdminRoutes adds a JSON API for inspecting and manipulating
+// the state of the running server. When the token is not empty,
+// each request must provide it in a `Authorization: Bearer` header.
+// The group can belong to a different echo instance than the server.
+func (s *Server) AddAdminRoutes(group *echo.Group, token string) {
+	group.Use(adminAuth(token))
+
+	cachedCount := func() int {
+		count := 0
+		for _, routes := range s.Mounts() {
+			count += routes.Cache().Count()
+		}
+		return count
+	}
+
+	group.GET("/cache", func(c echo.Context) error {
+		result := make([]CachedFileInfo, 0, cachedCount())
+		for _, routes := range s.Mounts() {
+			iter := routes.Cache().Iterator()
+			for !iter.Done() {
+				file, _ := iter.Next()
+				result = append(result, CachedFileInfo{
+					Mount:        routes.Mount(),
+					Path:         file.Path,
+					RelPath:      file.RelPath,
+					Size:         file.Length(),
+					ContentType:  file.ContentType,
+					Etag:         file.Etag,
+					LastModified: *file.LastModifiedAt,
+				})
+			}
+		}
+		return c.JSON(200, result)
+	})
+
+	group.DELETE("/cache", func(c echo.Context) error {
+		count := 0
+		for _, routes := range s.Mounts() {
+			count += routes.Cache().Count()
+			routes.Cache().Clear()
+		}
+		return c.JSON(200, map[string]int{"purged": count})
+	})
+
+	// the path is the url path of the file, including the mount prefix
+	group.DELETE("/cache/*", func(c echo.Context) error {
+		routes, relPath := findMount(s.Mounts(), c.Param("*"))
+		if routes == nil {
+			return c.JSON(404, map[string]string{"error": "file not in cache"})
+		}
+		file := routes.Cache().Peek(relPath)
+		if file == nil || !routes.Cache().Remove(file) {
+			return c.JSON(404, map[string]string{"error": "file not in cache"})
+		}
+		return c.JSON(200, map[string]int{"purged": 1})
+	})
+
+	group.POST("/rescan", func(c echo.Context) error {
+		for _, routes := range s.Mounts() {
+			routes.Rescan()
+		}
+		return c.JSON(200, map[string]int{"cached": cachedCount()})
+	})
+
+	group.GET("/hmr/clients", func(c echo.Context) error {
+		return c.JSON(200, s.clients.Clients())
+	})
+
+	group.POST("/hmr/broadcast", func(c echo.Context) error {
+		body := &BroadcastRequest{}
+		err := c.Bind(body)
+		if err != nil || body.Message == "" {
+			return c.JSON(400, map[string]string{"error": "expected a json body with a 'message' field"})
+		}
+		recipients := s.clients.SendTo(body.Target, &utils.HmrMessage{
+			Type: utils.HmrCustom,
+			Data: body.Message,
+		})
+		return c.JSON(200, map[string]int{"recipients": recipients})
+	})
+
+	group.POST("/hmr/error", func(c echo.Context) error {
+		body := &BuildError{}
+		err := c.Bind(body)
+		if err != nil || body.Message == "" {
+			return c.JSON(400, map[string]string{"error": "expected a json body with a 'message' field"})
+		}
+		s.buildErrors.Report(*body)
+		return c.JSON(200, map[string]int{"recipients": s.clients.Count()})
+	})
+
+	group.DELETE("/hmr/error", func(c echo.Context) error {
+		s.buildErrors.Clear()
+		return c.JSON(200, map[string]int{"recipients": s.clients.Count()})
+	})
+}
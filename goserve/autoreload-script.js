@@ -0,0 +1,62 @@
+(function () {
+  let reloading = false;
+
+  // a batch of changes can trigger multiple reloads, only the first
+  // one needs to be done
+  function reload() {
+    if (!reloading) {
+      reloading = true;
+      location.reload();
+    }
+  }
+
+  HMR.onCurrentPageChange(() => {
+    console.log("Current page changed, reloading...");
+    reload();
+  });
+
+  const IMAGE_EXT = /\.(png|jpe?g|gif|webp|avif|svg|ico|bmp)$/i;
+
+  function matchesFile(src, file) {
+    const url = new URL(src, location.href);
+    return (
+      url.origin === location.origin &&
+      decodeURIComponent(url.pathname).replace(/^\//, "") === file
+    );
+  }
+
+  /**
+   * Reloads the images using the given file in place,
+   * returns false if none were found.
+   */
+  function swapImages(file) {
+    let swapped = false;
+    for (const img of document.images) {
+      if (img.src && matchesFile(img.src, file)) {
+        const url = new URL(img.src, location.href);
+        url.searchParams.set("_serve_t", String(Date.now()));
+        img.src = url.href;
+        swapped = true;
+      }
+    }
+    return swapped;
+  }
+
+  HMR.onCurrentPageDependencyChange((ev) => {
+    if (HMR.hotCss && ev.file.endsWith(".css")) {
+      // handled by the css hot-swap script
+      return;
+    }
+    if (HMR.isHotModule(ev.file)) {
+      // replaced by the module hot replacement, which reloads
+      // the page itself if the update isn't accepted
+      return;
+    }
+    if (IMAGE_EXT.test(ev.file) && swapImages(ev.file)) {
+      console.log(`Image ${ev.file} changed, swapped in place`);
+      return;
+    }
+    console.log(`Dependency ${ev.file} changed, reloading...`);
+    reload();
+  });
+})();
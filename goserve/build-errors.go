@@ -0,0 +1,120 @@
+package goserve
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncpa0cpl/static-server/utils"
+)
+
+type BuildError struct {
+	Message string `json:"message"`
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+}
+
+// ErrorReporter keeps track of the last reported build error, which
+// is displayed by the clients in an overlay until a file changes or
+// the error is cleared.
+type ErrorReporter struct {
+	mutex   *sync.Mutex
+	clients *utils.WsController
+	current *utils.HmrMessage
+}
+
+func CreateErrorReporter(clients *utils.WsController) *ErrorReporter {
+	return &ErrorReporter{
+		mutex:   &sync.Mutex{},
+		clients: clients,
+	}
+}
+
+// Report sends the error to all the HMR clients, the error is also
+// sent to the clients that connect later on, until it's cleared.
+func (r *ErrorReporter) Report(buildErr BuildError) {
+	msg := &utils.HmrMessage{
+		Type:   utils.HmrError,
+		Data:   buildErr.Message,
+		File:   buildErr.File,
+		Line:   buildErr.Line,
+		Column: buildErr.Column,
+	}
+
+	r.mutex.Lock()
+	r.current = msg
+	r.mutex.Unlock()
+
+	r.clients.SendToAll(msg)
+}
+
+// Clear tells the clients to hide the error overlay,
+// if an error was reported.
+func (r *ErrorReporter) Clear() {
+	r.mutex.Lock()
+	hadError := r.current != nil
+	r.current = nil
+	r.mutex.Unlock()
+
+	if hadError {
+		r.clients.SendToAll(&utils.HmrMessage{Type: utils.HmrErrorCleared})
+	}
+}
+
+// Reset forgets the reported error without notifying the clients,
+// used when a file change is sent, which the clients already treat
+// as the error being resolved.
+func (r *ErrorReporter) Reset() {
+	r.mutex.Lock()
+	r.current = nil
+	r.mutex.Unlock()
+}
+
+// Current returns the message of the reported error, or nil.
+func (r *ErrorReporter) Current() *utils.HmrMessage {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.current
+}
+
+// sendCurrent sends the reported error, if there is one,
+// to a newly connected client.
+func (r *ErrorReporter) sendCurrent(client *utils.WsClient) {
+	if msg := r.Current(); msg != nil {
+		r.clients.Send(client, msg)
+	}
+}
+
+// ReadErrors reads JSON encoded build errors, one per line, and reports
+// them. A line with an empty message clears the reported error.
+func (r *ErrorReporter) ReadErrors(input io.Reader, logger echo.Logger) {
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		buildErr := BuildError{}
+		err := json.Unmarshal(line, &buildErr)
+		if err != nil {
+			logger.Errorf("Invalid build error received on stdin: %s", err.Error())
+			continue
+		}
+
+		if buildErr.Message == "" {
+			r.Clear()
+		} else {
+			r.Report(buildErr)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		logger.Errorf("Failed to read build errors from stdin: %s", err.Error())
+	}
+}
@@ -0,0 +1,163 @@
+package goserve
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncpa0cpl/static-server/utils"
+)
+
+// Builder runs the user's build command each time the watched
+// sources change. A build started while another one is still running
+// cancels the previous one. Changes to the served files are held back
+// while a build is in progress, and sent to the HMR clients once a
+// build succeeds, the ones held during a failed build wait for the
+// next successful one.
+type Builder struct {
+	command string
+	logger  echo.Logger
+	onDone  func(ok bool, output string, held []utils.WatchEvent)
+
+	mutex   *sync.Mutex
+	current *exec.Cmd
+	// incremented on each build, to tell if the build that finished
+	// is still the latest one
+	generation uint64
+	held       []utils.WatchEvent
+	// set when the last build failed, the events are held until a
+	// build succeeds, including the ones for the files the failed
+	// build wrote just before it exited
+	failed bool
+}
+
+func CreateBuilder(command string, logger echo.Logger, onDone func(ok bool, output string, held []utils.WatchEvent)) *Builder {
+	return &Builder{
+		command: command,
+		logger:  logger,
+		onDone:  onDone,
+		mutex:   &sync.Mutex{},
+		held:    make([]utils.WatchEvent, 0),
+	}
+}
+
+// Hold keeps the events until the next build finishes.
+func (b *Builder) Hold(events []utils.WatchEvent) {
+	b.mutex.Lock()
+	b.held = utils.MergeEvents(b.held, events...)
+	b.mutex.Unlock()
+}
+
+// holdIfBusy keeps the events if a build is currently running, or
+// the last one failed, returns false otherwise.
+func (b *Builder) holdIfBusy(events []utils.WatchEvent) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.current == nil && !b.failed {
+		return false
+	}
+	b.held = utils.MergeEvents(b.held, events...)
+	return true
+}
+
+// OnWatchEvents wraps the flush callback of the watcher event batcher.
+// Changes to the additional watched directories start a build, and
+// all events are held while a build is running, or after a failed
+// one, and passed to the done callback once a build succeeds.
+func (b *Builder) OnWatchEvents(broadcast func([]utils.WatchEvent)) func([]utils.WatchEvent) {
+	return func(events []utils.WatchEvent) {
+		sourcesChanged := false
+		for _, ev := range events {
+			if ev.Root != "" {
+				sourcesChanged = true
+				break
+			}
+		}
+
+		if sourcesChanged {
+			b.Hold(events)
+			b.Trigger()
+			return
+		}
+		if !b.holdIfBusy(events) {
+			broadcast(events)
+		}
+	}
+}
+
+// Trigger starts a new build, cancelling the running one.
+func (b *Builder) Trigger() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.current != nil {
+		b.logger.Info("Sources changed, cancelling the running build")
+		utils.KillProcessTree(b.current)
+	}
+
+	b.generation++
+	generation := b.generation
+
+	output := utils.CreateTailBuffer(16 * 1024)
+	cmd := utils.ShellCommand(b.command)
+	cmd.Stdout = io.MultiWriter(os.Stdout, output)
+	cmd.Stderr = io.MultiWriter(os.Stderr, output)
+
+	b.logger.Infof("Running build: %s", b.command)
+	start := time.Now()
+
+	err := cmd.Start()
+	if err != nil {
+		b.logger.Errorf("Failed to start the build: %s", err.Error())
+		b.current = nil
+		b.failed = true
+		go b.onDone(false, err.Error(), nil)
+		return
+	}
+	b.current = cmd
+
+	go func() {
+		err := cmd.Wait()
+
+		b.mutex.Lock()
+		if b.generation != generation {
+			// cancelled by a newer build
+			b.mutex.Unlock()
+			return
+		}
+		b.current = nil
+		// the held events are kept until a build succeeds
+		b.failed = err != nil
+		var held []utils.WatchEvent
+		if err == nil {
+			held = b.held
+			b.held = make([]utils.WatchEvent, 0)
+		}
+		b.mutex.Unlock()
+
+		if err != nil {
+			b.logger.Errorf("Build failed after %s: %s", time.Since(start).Round(time.Millisecond), err.Error())
+			b.onDone(false, strings.TrimSpace(output.String()), nil)
+			return
+		}
+
+		b.logger.Infof("Build finished in %s", time.Since(start).Round(time.Millisecond))
+		b.onDone(true, "", held)
+	}()
+}
+
+// Stop kills the running build, if there is one.
+func (b *Builder) Stop() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.generation++
+	if b.current != nil {
+		utils.KillProcessTree(b.current)
+		b.current = nil
+	}
+}
@@ -0,0 +1,78 @@
+package goserve
+
+import (
+	"io"
+	"os"
+	fp "path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncpa0cpl/static-server/utils"
+)
+
+type buildResult struct {
+	ok   bool
+	held []utils.WatchEvent
+}
+
+func TestBuilderHoldsEventsAfterFailure(t *testing.T) {
+	okFile := fp.Join(t.TempDir(), "ok")
+	results := make(chan buildResult, 1)
+	broadcasts := make(chan []utils.WatchEvent, 1)
+
+	logger := echo.New().Logger
+	logger.SetOutput(io.Discard)
+	b := CreateBuilder("test -e "+okFile, logger, func(ok bool, _ string, held []utils.WatchEvent) {
+		results <- buildResult{ok, held}
+	})
+	onFlush := b.OnWatchEvents(func(events []utils.WatchEvent) {
+		broadcasts <- events
+	})
+	defer b.Stop()
+
+	waitBuild := func() buildResult {
+		select {
+		case result := <-results:
+			return result
+		case <-time.After(5 * time.Second):
+			t.Fatal("the build did not finish")
+			return buildResult{}
+		}
+	}
+
+	source := utils.WatchEvent{Op: utils.HmrChanged, Path: "/src/a.ts", Root: "src"}
+	output := utils.WatchEvent{Op: utils.HmrChanged, Path: "/dist/a.js"}
+
+	onFlush([]utils.WatchEvent{source})
+	if result := waitBuild(); result.ok {
+		t.Fatal("the build succeeded")
+	}
+
+	// the output of the failed build, flushed after the build exited
+	onFlush([]utils.WatchEvent{output})
+	select {
+	case events := <-broadcasts:
+		t.Fatalf("events broadcast after a failed build: %+v", events)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	os.WriteFile(okFile, nil, 0644)
+	onFlush([]utils.WatchEvent{source})
+	result := waitBuild()
+	if want := []utils.WatchEvent{source, output}; !result.ok || !reflect.DeepEqual(result.held, want) {
+		t.Fatalf("build = %+v, want ok with %+v", result, want)
+	}
+
+	// after a successful build the events are sent right away
+	onFlush([]utils.WatchEvent{output})
+	select {
+	case events := <-broadcasts:
+		if !reflect.DeepEqual(events, []utils.WatchEvent{output}) {
+			t.Errorf("broadcast = %+v", events)
+		}
+	case <-time.After(time.Second):
+		t.Error("events not broadcast after a successful build")
+	}
+}
@@ -0,0 +1,80 @@
+package goserve
+
+import (
+	_ "embed"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncpa0cpl/static-server/utils"
+)
+
+//go:embed hmr-script.js
+var HMR_SCRIPT string
+
+//go:embed autoreload-script.js
+var AUTORELOAD_SCRIPT string
+
+//go:embed css-reload-script.js
+var CSS_RELOAD_SCRIPT string
+
+//go:embed error-overlay-script.js
+var ERROR_OVERLAY_SCRIPT string
+
+//go:embed hot-modules-script.js
+var HOT_MODULES_SCRIPT string
+
+const (
+	HmrScriptPath        = "/__serve/hmr.js"
+	HmrModulePath        = "/__serve/hmr.mjs"
+	AutoReloadScriptPath = "/__serve/autoreload.js"
+	CssReloadScriptPath  = "/__serve/css-reload.js"
+)
+
+type clientScript struct {
+	content []byte
+	etag    string
+}
+
+func createClientScript(parts ...string) *clientScript {
+	content := []byte{}
+	for _, part := range parts {
+		content = append(content, part...)
+		content = append(content, '\n')
+	}
+	return &clientScript{
+		content: content,
+		etag:    utils.HashBytes(content),
+	}
+}
+
+// the ES module variant runs the same code as the classic script,
+// unless it was already loaded by the page, or it's imported by a
+// worker, where it exports undefined. The exported binding is not
+// named HMR, it would shadow the global used by the scripts.
+const hmrModulePrefix = "if (typeof window !== \"undefined\" && !window.HMR) {\n"
+const hmrModuleSuffix = "}\n\nconst hmr = globalThis.HMR;\nexport { hmr as HMR };\nexport default hmr;"
+
+var clientScripts = map[string]*clientScript{
+	HmrScriptPath:        createClientScript(HMR_SCRIPT, ERROR_OVERLAY_SCRIPT, HOT_MODULES_SCRIPT),
+	HmrModulePath:        createClientScript(hmrModulePrefix, HMR_SCRIPT, ERROR_OVERLAY_SCRIPT, HOT_MODULES_SCRIPT, hmrModuleSuffix),
+	AutoReloadScriptPath: createClientScript(AUTORELOAD_SCRIPT),
+	CssReloadScriptPath:  createClientScript(CSS_RELOAD_SCRIPT),
+}
+
+// addClientScriptRoutes serves the HMR client scripts, these are
+// included by the pages via the injected script tags, or explicitly
+// by the pages and apps that don't get them injected.
+func addClientScriptRoutes(server *echo.Echo) {
+	for path, script := range clientScripts {
+		script := script
+		server.GET(path, func(c echo.Context) error {
+			h := c.Response().Header()
+			h.Set("Cache-Control", "no-cache")
+			h.Set("ETag", script.etag)
+
+			if c.Request().Header.Get("If-None-Match") == script.etag {
+				return c.NoContent(304)
+			}
+			return c.Blob(200, "text/javascript; charset=utf-8", script.content)
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package goserve
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	fp "path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ncpa0cpl/static-server/utils"
+)
+
+// characters allowed in a CSP nonce (base64 and base64url)
+var cspNonceValueRegex = regexp.MustCompile(`^[A-Za-z0-9+/=_-]*$`)
+
+func (conf *Configuration) Validate() error {
+	if conf.SpaFile != "" && conf.RedirectTo != "" {
+		return fmt.Errorf("cannot specify both spaFile and redirectTo")
+	}
+	if conf.ChunkSize == 0 {
+		return fmt.Errorf("chunkSize must be greater than 0")
+	}
+	if conf.WatchMode != utils.WatchModeNative && conf.WatchMode != utils.WatchModePoll {
+		return fmt.Errorf("invalid watchMode: %q", conf.WatchMode)
+	}
+	for _, dir := range conf.WatchExtra {
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() {
+			return fmt.Errorf("watchExtra directory does not exist: %s", dir)
+		}
+	}
+	if conf.OnChange != "" && len(conf.WatchExtra) == 0 {
+		// the build output usually lands in the served directory,
+		// rebuilding on its changes would never stop
+		return fmt.Errorf("onChange requires at least one watchExtra directory with the sources, the changes of the served files don't start a build")
+	}
+	if conf.WatchDebounce < 0 {
+		return fmt.Errorf("watchDebounce cannot be negative")
+	}
+	if !cspNonceValueRegex.MatchString(conf.CspNonce) {
+		return fmt.Errorf("invalid cspNonce: %q", conf.CspNonce)
+	}
+	prefixes := map[string]bool{}
+	for _, mount := range conf.Mounts {
+		prefix := NormalizeMountPrefix(mount.Prefix)
+		if prefixes[prefix] {
+			return fmt.Errorf("duplicate mount prefix: %q", mount.Prefix)
+		}
+		prefixes[prefix] = true
+	}
+	if conf.MaxAge < 0 {
+		return fmt.Errorf("maxAge cannot be negative")
+	}
+	for name := range conf.Headers {
+		if name == "" || strings.ContainsAny(name, " :\r\n") {
+			return fmt.Errorf("invalid header name: %q", name)
+		}
+	}
+	return nil
+}
+
+// Mount is a directory served under a url prefix. The options
+// override the ones of the main configuration for its files.
+type Mount struct {
+	Prefix string `json:"prefix"`
+	Dir    string `json:"dir"`
+	// directories the files missing in Dir are served from
+	Fallback []string        `json:"fallback,omitempty"`
+	Options  json.RawMessage `json:"options,omitempty"`
+}
+
+// NormalizeMountPrefix returns the prefix with a leading slash and no
+// trailing one, or an empty string for the server root.
+func NormalizeMountPrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return "/" + prefix
+}
+
+// ParseMount parses a mount given as `<prefix>=<dir>`, the directory
+// can be followed by the fallback directories, separated like in the
+// PATH environment variable, e.g. `/static=./public:./dist`.
+func ParseMount(value string) (Mount, error) {
+	prefix, dirs, ok := strings.Cut(value, "=")
+	list := fp.SplitList(dirs)
+	if !ok || len(list) == 0 || slices.Contains(list, "") {
+		return Mount{}, fmt.Errorf("invalid mount %q, expected <prefix>=<dir>", value)
+	}
+	mount := Mount{Prefix: prefix, Dir: list[0]}
+	if len(list) > 1 {
+		mount.Fallback = list[1:]
+	}
+	return mount, nil
+}
+
+// ForMount returns the configuration of the files served from the
+// mount, a copy of this configuration with the mount options applied.
+// Only the primary mount inherits the build command and the extra
+// watched directories, so these are not run and watched once for
+// every mount.
+func (conf *Configuration) ForMount(mount Mount, primary bool) (*Configuration, error) {
+	mountConf := *conf
+	mountConf.Mounts = nil
+	if !primary {
+		mountConf.WatchExtra = nil
+		mountConf.OnChange = ""
+	}
+
+	if len(mount.Options) > 0 {
+		err := json.Unmarshal(mount.Options, &mountConf)
+		if err != nil {
+			return nil, fmt.Errorf("invalid options of the mount %q: %s", mount.Prefix, err.Error())
+		}
+	}
+
+	err := mountConf.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("mount %q: %s", mount.Prefix, err.Error())
+	}
+	return &mountConf, nil
+}
+
+// LoadConfigFile reads a JSON configuration file on top
+// of a copy of the given base configuration.
+func LoadConfigFile(filepath string, base *Configuration) (*Configuration, error) {
+	content, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := *base
+	err = json.Unmarshal(content, &conf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file(%s): %s", filepath, err.Error())
+	}
+
+	return &conf, nil
+}
+
+// WatchConfigFile polls the modification time of the config file
+// and calls the callback each time it changes, until the returned
+// stop function is called.
+func WatchConfigFile(filepath string, interval time.Duration, onChange func()) (stop func()) {
+	done := make(chan struct{})
+
+	var lastMod time.Time
+	if info, err := os.Stat(filepath); err == nil {
+		lastMod = info.ModTime()
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				info, err := os.Stat(filepath)
+				if err != nil || info.ModTime().Equal(lastMod) {
+					continue
+				}
+				lastMod = info.ModTime()
+				onChange()
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
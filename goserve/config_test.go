@@ -0,0 +1,36 @@
+package goserve
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMount(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Mount
+		wantErr bool
+	}{
+		{value: "/static=./dist", want: Mount{Prefix: "/static", Dir: "./dist"}},
+		{value: "=./dist", want: Mount{Dir: "./dist"}},
+		{
+			value: "/static=./public:./dist:./vendor",
+			want:  Mount{Prefix: "/static", Dir: "./public", Fallback: []string{"./dist", "./vendor"}},
+		},
+		{value: "/static", wantErr: true},
+		{value: "/static=", wantErr: true},
+		{value: "/static=./public::./dist", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseMount(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMount() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseMount() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
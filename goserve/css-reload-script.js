@@ -0,0 +1,28 @@
+HMR.hotCss = true;
+
+HMR.onChange((ev) => {
+  if (ev.root || !ev.file.endsWith(".css")) {
+    return;
+  }
+
+  const links = document.querySelectorAll("link[rel='stylesheet']");
+  for (const link of links) {
+    const url = new URL(link.href, location.href);
+    if (url.origin !== location.origin) {
+      continue;
+    }
+    if (decodeURIComponent(url.pathname).replace(/^\//, "") !== ev.file) {
+      continue;
+    }
+
+    console.log(`Stylesheet ${ev.file} changed, swapping...`);
+
+    // keep the old stylesheet until the new one is loaded to avoid
+    // a flash of unstyled content
+    url.searchParams.set("_serve_t", String(Date.now()));
+    const next = link.cloneNode();
+    next.href = url.href;
+    next.onload = next.onerror = () => link.remove();
+    link.after(next);
+  }
+});
@@ -0,0 +1,112 @@
+package goserve
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncpa0cpl/static-server/utils"
+)
+
+// DependencyTracker records which files were requested by which
+// pages, based on the Referer header of the requests, so that pages
+// can be notified when any of the resources they use changes.
+type DependencyTracker struct {
+	mutex *sync.Mutex
+
+	// url path -> served path of the file served under that url
+	urlToFile map[string]string
+	// served path -> served paths of files that requested it
+	dependents map[string]map[string]struct{}
+	// served paths of the html files
+	pages map[string]struct{}
+}
+
+func CreateDependencyTracker() *DependencyTracker {
+	return &DependencyTracker{
+		mutex:      &sync.Mutex{},
+		urlToFile:  make(map[string]string),
+		dependents: make(map[string]map[string]struct{}),
+		pages:      make(map[string]struct{}),
+	}
+}
+
+func (t *DependencyTracker) Record(c echo.Context, file *StaticFile) {
+	req := c.Request()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.urlToFile[req.URL.Path] = file.ServedPath
+	if strings.Contains(file.ContentType, "text/html") {
+		t.pages[file.ServedPath] = struct{}{}
+	}
+
+	referer := req.Referer()
+	if referer == "" {
+		return
+	}
+	refUrl, err := url.Parse(referer)
+	if err != nil || refUrl.Host != req.Host {
+		return
+	}
+	refFile, ok := t.urlToFile[refUrl.Path]
+	if !ok || refFile == file.ServedPath {
+		return
+	}
+
+	dependents, ok := t.dependents[file.ServedPath]
+	if !ok {
+		dependents = make(map[string]struct{})
+		t.dependents[file.ServedPath] = dependents
+	}
+	dependents[refFile] = struct{}{}
+}
+
+// PagesDependingOn returns the html files that requested the given
+// file, either directly or through other resources (e.g. an image
+// loaded by a stylesheet).
+func (t *DependencyTracker) PagesDependingOn(servedPath string) []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	visited := map[string]struct{}{servedPath: {}}
+	queue := []string{servedPath}
+	pages := make([]string, 0)
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for dependent := range t.dependents[current] {
+			if _, ok := visited[dependent]; ok {
+				continue
+			}
+			visited[dependent] = struct{}{}
+			queue = append(queue, dependent)
+
+			if _, isPage := t.pages[dependent]; isPage {
+				pages = append(pages, dependent)
+			}
+		}
+	}
+
+	sort.Strings(pages)
+	return pages
+}
+
+// DependentsMessages creates a HMR message for each page that
+// depends on the file the given message is about.
+func (t *DependencyTracker) DependentsMessages(fileMsg *utils.HmrMessage) []*utils.HmrMessage {
+	pages := t.PagesDependingOn(fileMsg.Path)
+	result := make([]*utils.HmrMessage, 0, len(pages))
+	for _, page := range pages {
+		msg := *fileMsg
+		msg.Type = utils.HmrDependencyChanged
+		msg.Page = page
+		result = append(result, &msg)
+	}
+	return result
+}
@@ -0,0 +1,158 @@
+(function () {
+  /** @type {HTMLElement | undefined} */
+  let overlay;
+
+  // needed for the overlay styles under a Content-Security-Policy
+  const nonce = document.currentScript && document.currentScript.nonce;
+
+  const STYLE = `
+    :host {
+      position: fixed;
+      inset: 0;
+      z-index: 2147483647;
+      display: flex;
+      align-items: flex-start;
+      justify-content: center;
+      padding: 5vh 16px;
+      background: rgba(0, 0, 0, 0.6);
+      font-family: ui-monospace, SFMono-Regular, Menlo, Consolas, monospace;
+      font-size: 14px;
+    }
+    .window {
+      box-sizing: border-box;
+      width: 100%;
+      max-width: 960px;
+      max-height: 90vh;
+      overflow: auto;
+      padding: 20px 24px;
+      border-top: 6px solid #e5484d;
+      border-radius: 6px;
+      background: #1c1c1f;
+      color: #ededef;
+      box-shadow: 0 10px 40px rgba(0, 0, 0, 0.5);
+    }
+    .header {
+      display: flex;
+      align-items: center;
+      justify-content: space-between;
+      gap: 16px;
+    }
+    .title {
+      margin: 0;
+      color: #ff6369;
+      font-size: 16px;
+    }
+    .location {
+      margin-top: 8px;
+      color: #a0a0ab;
+    }
+    .close {
+      border: none;
+      background: none;
+      color: #a0a0ab;
+      font: inherit;
+      font-size: 20px;
+      cursor: pointer;
+    }
+    .close:hover {
+      color: #ededef;
+    }
+    pre {
+      margin: 16px 0 0;
+      white-space: pre-wrap;
+      word-break: break-word;
+    }
+  `;
+
+  function hide() {
+    if (overlay) {
+      overlay.remove();
+      overlay = undefined;
+    }
+  }
+
+  function formatLocation(ev) {
+    if (!ev.file) {
+      return "";
+    }
+    let location = ev.file;
+    if (ev.line) {
+      location += ":" + ev.line;
+      if (ev.column) {
+        location += ":" + ev.column;
+      }
+    }
+    return location;
+  }
+
+  /**
+   * @param {HMRErrorEvent} ev
+   */
+  function show(ev) {
+    hide();
+
+    overlay = document.createElement("serve-error-overlay");
+    // shadow root keeps the page styles from leaking into the overlay
+    const root = overlay.attachShadow({ mode: "open" });
+
+    const style = document.createElement("style");
+    style.textContent = STYLE;
+    if (nonce) {
+      style.nonce = nonce;
+    }
+
+    const win = document.createElement("div");
+    win.className = "window";
+
+    const header = document.createElement("div");
+    header.className = "header";
+    const title = document.createElement("h1");
+    title.className = "title";
+    title.textContent = "Build failed";
+    const close = document.createElement("button");
+    close.className = "close";
+    close.title = "Dismiss (Esc)";
+    close.textContent = "✕";
+    close.onclick = hide;
+    header.append(title, close);
+    win.append(header);
+
+    const location = formatLocation(ev);
+    if (location) {
+      const loc = document.createElement("div");
+      loc.className = "location";
+      loc.textContent = location;
+      win.append(loc);
+    }
+
+    const text = document.createElement("pre");
+    text.textContent = ev.data;
+    win.append(text);
+
+    root.append(style, win);
+    // clicking the backdrop dismisses the overlay, clicks within the
+    // shadow root are retargeted to the host, hence the composed path
+    overlay.addEventListener("click", (e) => {
+      if (e.composedPath()[0] === overlay) {
+        hide();
+      }
+    });
+
+    document.documentElement.append(overlay);
+  }
+
+  document.addEventListener("keydown", (e) => {
+    if (e.key === "Escape") {
+      hide();
+    }
+  });
+
+  HMR.onError(show);
+  HMR.onErrorClear(hide);
+
+  // any change means the files were rebuilt successfully
+  HMR.onChange(hide);
+  HMR.onCreate(hide);
+  HMR.onDelete(hide);
+  HMR.onRename(hide);
+})();
@@ -0,0 +1,424 @@
+class HMREvent extends Event {
+  constructor(type, file, oldFile, details = {}) {
+    super(type);
+    this.file = file;
+    this.oldFile = oldFile;
+    this.mtime = details.mtime;
+    this.size = details.size;
+    this.etag = details.etag;
+    this.batch = details.batch;
+    this.root = details.root;
+  }
+}
+
+class HMRMessageEvent extends Event {
+  constructor(type, data) {
+    super(type);
+    this.data = data;
+  }
+}
+
+class HMRErrorEvent extends HMRMessageEvent {
+  constructor(type, data, details = {}) {
+    super(type, data);
+    this.file = details.file;
+    this.line = details.line;
+    this.column = details.column;
+  }
+}
+
+(function () {
+  class HMR extends EventTarget {
+    static CHANGE = "change";
+    static CREATE = "create";
+    static DELETE = "delete";
+    static RENAME = "rename";
+    static MESSAGE = "message";
+    static DEPENDENCY_CHANGE = "dependencychange";
+    static BATCH = "batch";
+    static ERROR = "error";
+    static ERROR_CLEAR = "errorclear";
+
+    CHANGE = HMR.CHANGE;
+    CREATE = HMR.CREATE;
+    DELETE = HMR.DELETE;
+    RENAME = HMR.RENAME;
+    MESSAGE = HMR.MESSAGE;
+    DEPENDENCY_CHANGE = HMR.DEPENDENCY_CHANGE;
+    BATCH = HMR.BATCH;
+    ERROR = HMR.ERROR;
+    ERROR_CLEAR = HMR.ERROR_CLEAR;
+
+    onCurrentPageChange(callback, options) {
+      const currentFile = document.querySelector("meta[name='_serve:fname']");
+      return this.onChange((ev) => {
+        if (currentFile && !ev.root) {
+          if (currentFile.content === ev.file) {
+            callback(ev);
+          }
+        }
+      }, options);
+    }
+
+    /**
+     * Listen to changes of the resources (scripts, styles, images, etc.)
+     * requested by the current page.
+     */
+    onCurrentPageDependencyChange(callback, options) {
+      const currentFile = document.querySelector("meta[name='_serve:fname']");
+      const listener = (ev) => {
+        if (currentFile && currentFile.content === ev.page) {
+          callback(ev);
+        }
+      };
+      this.addEventListener(HMR.DEPENDENCY_CHANGE, listener, options);
+      return () => {
+        this.removeEventListener(HMR.DEPENDENCY_CHANGE, listener);
+      };
+    }
+
+    onChange(callback, options) {
+      this.addEventListener(HMR.CHANGE, callback, options);
+      return () => {
+        this.removeEventListener(HMR.CHANGE, callback);
+      };
+    }
+
+    onCreate(callback, options) {
+      this.addEventListener(HMR.CREATE, callback, options);
+      return () => {
+        this.removeEventListener(HMR.CREATE, callback);
+      };
+    }
+
+    onDelete(callback, options) {
+      this.addEventListener(HMR.DELETE, callback, options);
+      return () => {
+        this.removeEventListener(HMR.DELETE, callback);
+      };
+    }
+
+    onRename(callback, options) {
+      this.addEventListener(HMR.RENAME, callback, options);
+      return () => {
+        this.removeEventListener(HMR.RENAME, callback);
+      };
+    }
+
+    onMessage(callback, options) {
+      this.addEventListener(HMR.MESSAGE, callback, options);
+      return () => {
+        this.removeEventListener(HMR.MESSAGE, callback);
+      };
+    }
+
+    /**
+     * Called once after all events from a single batch of fs
+     * changes were dispatched.
+     */
+    onBatch(callback, options) {
+      this.addEventListener(HMR.BATCH, callback, options);
+      return () => {
+        this.removeEventListener(HMR.BATCH, callback);
+      };
+    }
+
+    /**
+     * Called when a build error is reported, either by the `--on-change`
+     * build command or by an external tool. `ev.data` holds the error
+     * text, and `ev.file`, `ev.line` and `ev.column` its location if known.
+     */
+    onError(callback, options) {
+      this.addEventListener(HMR.ERROR, callback, options);
+      return () => {
+        this.removeEventListener(HMR.ERROR, callback);
+      };
+    }
+
+    /**
+     * Called when the reported build error was explicitly cleared.
+     */
+    onErrorClear(callback, options) {
+      this.addEventListener(HMR.ERROR_CLEAR, callback, options);
+      return () => {
+        this.removeEventListener(HMR.ERROR_CLEAR, callback);
+      };
+    }
+
+    /**
+     * Identify the client to the server, so that messages can be
+     * targeted to the page or groups of clients.
+     *
+     * @param {{ page?: string, groups?: string[] }} identity
+     */
+    identify(identity) {
+      if (identity.page !== undefined) {
+        client.page = identity.page;
+      }
+      if (identity.groups !== undefined) {
+        client.groups = identity.groups;
+      }
+      sendHello();
+    }
+
+    /**
+     * Receive file events only for the paths matching one of the
+     * subscribed glob patterns (events for all files are received
+     * until the first subscription).
+     *
+     * @param {string | string[]} patterns
+     */
+    subscribe(patterns) {
+      patterns = [].concat(patterns);
+      patterns.forEach((p) => client.subscriptions.add(p));
+      send({ type: "subscribe", patterns });
+      return () => this.unsubscribe(patterns);
+    }
+
+    /**
+     * @param {string | string[]} patterns
+     */
+    unsubscribe(patterns) {
+      patterns = [].concat(patterns);
+      patterns.forEach((p) => client.subscriptions.delete(p));
+      send({ type: "unsubscribe", patterns });
+    }
+
+    emitChanged(file, details) {
+      this.dispatchEvent(new HMREvent(HMR.CHANGE, file, undefined, details));
+    }
+
+    emitCreated(file, details) {
+      this.dispatchEvent(new HMREvent(HMR.CREATE, file, undefined, details));
+    }
+
+    emitDeleted(file, details) {
+      this.dispatchEvent(new HMREvent(HMR.DELETE, file, undefined, details));
+    }
+
+    emitRenamed(file, oldFile, details) {
+      this.dispatchEvent(new HMREvent(HMR.RENAME, file, oldFile, details));
+    }
+
+    emitDependencyChanged(page, file, details) {
+      const ev = new HMREvent(HMR.DEPENDENCY_CHANGE, file, undefined, details);
+      ev.page = page;
+      this.dispatchEvent(ev);
+    }
+
+    emitBatch(batch, events) {
+      const ev = new Event(HMR.BATCH);
+      ev.batch = batch;
+      ev.events = events;
+      this.dispatchEvent(ev);
+    }
+
+    emitMessage(data) {
+      this.dispatchEvent(new HMRMessageEvent(HMR.MESSAGE, data));
+    }
+
+    emitError(data, details) {
+      this.dispatchEvent(new HMRErrorEvent(HMR.ERROR, data, details));
+    }
+
+    emitErrorClear() {
+      this.dispatchEvent(new Event(HMR.ERROR_CLEAR));
+    }
+  }
+
+  const instance = new HMR();
+
+  if (typeof window !== "undefined") {
+    window.HMR = instance;
+  }
+
+  /**
+   * @param {MessageEvent<string>} ev
+   */
+  function onHmrEvent(ev) {
+    const msg = JSON.parse(ev.data);
+    if (msg.id) {
+      lastEventId = msg.id;
+    }
+    handleMessage(msg);
+  }
+
+  function handleMessage(msg) {
+    switch (msg.type) {
+      case "changed":
+        instance.emitChanged(msg.path, msg);
+        break;
+      case "created":
+        instance.emitCreated(msg.path, msg);
+        break;
+      case "deleted":
+        instance.emitDeleted(msg.path, msg);
+        break;
+      case "renamed":
+        instance.emitRenamed(msg.path, msg.oldPath, msg);
+        break;
+      case "depchanged":
+        instance.emitDependencyChanged(msg.page, msg.path, msg);
+        break;
+      case "custom":
+        instance.emitMessage(msg.data);
+        break;
+      case "error":
+        console.error("Build failed:\n" + msg.data);
+        instance.emitError(msg.data, msg);
+        break;
+      case "errorcleared":
+        instance.emitErrorClear();
+        break;
+      case "connected":
+        onConnected(msg);
+        break;
+      case "batch":
+        for (const event of msg.events) {
+          handleMessage(event);
+        }
+        instance.emitBatch(msg.batch, msg.events);
+        break;
+    }
+  }
+
+  const PROTOCOL_VERSION = 1;
+
+  const currentFile = document.querySelector("meta[name='_serve:fname']");
+  const client = {
+    page: currentFile
+      ? currentFile.content
+      : decodeURIComponent(location.pathname).replace(/^\//, ""),
+    groups: [],
+    subscriptions: new Set(),
+  };
+
+  /** @type {WebSocket | undefined} */
+  let socket;
+  /** @type {EventSource | undefined} */
+  let eventSource;
+  let clientId;
+  let bootId;
+  let lastEventId;
+  let retries = 0;
+
+  function send(msg) {
+    const body = JSON.stringify(msg);
+    if (socket && socket.readyState === WebSocket.OPEN) {
+      socket.send(body);
+    } else if (eventSource && clientId !== undefined) {
+      // event streams are one-way, messages are posted instead
+      fetch("/__serve_hmr/events?client=" + clientId, {
+        method: "POST",
+        body,
+      });
+    }
+  }
+
+  function sendHello() {
+    send({ type: "hello", page: client.page, groups: client.groups });
+  }
+
+  function onConnected(msg) {
+    retries = 0;
+    clientId = msg.clientId;
+
+    if (bootId !== undefined && bootId !== msg.bootId) {
+      // the message ids of the previous server instance are meaningless
+      lastEventId = undefined;
+      console.log("HMR server was restarted");
+      reloadIfPageChanged();
+    }
+    bootId = msg.bootId;
+
+    sendHello();
+    if (client.subscriptions.size > 0) {
+      send({ type: "subscribe", patterns: [...client.subscriptions] });
+    }
+  }
+
+  /**
+   * Compares the modification time of the current page with the one
+   * served now, the files might have changed while the server was down.
+   */
+  async function reloadIfPageChanged() {
+    const mtime = document.querySelector("meta[name='_serve:mtime']");
+    if (!mtime) {
+      location.reload();
+      return;
+    }
+    try {
+      const resp = await fetch(location.href, { cache: "no-store" });
+      const lastModified = Date.parse(resp.headers.get("Last-Modified"));
+      // Last-Modified has a precision of seconds
+      if (Math.floor(Number(mtime.content) / 1000) !== lastModified / 1000) {
+        location.reload();
+      }
+    } catch {
+      location.reload();
+    }
+  }
+
+  function connectionQuery() {
+    let query = "?v=" + PROTOCOL_VERSION;
+    if (bootId !== undefined) {
+      query += "&bootId=" + bootId;
+    }
+    if (lastEventId !== undefined) {
+      query += "&lastEventId=" + lastEventId;
+    }
+    return query;
+  }
+
+  function reconnect(connect) {
+    const delay = Math.min(500 * 2 ** retries, 30000);
+    retries++;
+    // jitter, so that many tabs don't reconnect all at once
+    setTimeout(connect, delay * (0.8 + Math.random() * 0.4));
+  }
+
+  function connectWebSocket() {
+    const protocol = location.protocol === "https:" ? "wss://" : "ws://";
+    socket = new WebSocket(
+      protocol + location.host + "/__serve_hmr" + connectionQuery()
+    );
+
+    let opened = false;
+    socket.onopen = () => {
+      opened = true;
+    };
+    socket.onmessage = onHmrEvent;
+    socket.onclose = () => {
+      socket = undefined;
+      clientId = undefined;
+      if (!opened && bootId === undefined) {
+        // never connected, e.g. a proxy that doesn't allow
+        // the connection upgrade
+        console.log("HMR WebSocket connection failed, falling back to SSE");
+        connectEventStream();
+        return;
+      }
+      reconnect(connectWebSocket);
+    };
+  }
+
+  function connectEventStream() {
+    eventSource = new EventSource(
+      "/__serve_hmr/events" + connectionQuery()
+    );
+    eventSource.addEventListener("connected", (ev) => {
+      onConnected(JSON.parse(ev.data));
+    });
+    eventSource.onmessage = onHmrEvent;
+    eventSource.onerror = () => {
+      // reconnect with a backoff instead of the fixed EventSource delay
+      eventSource.close();
+      eventSource = undefined;
+      clientId = undefined;
+      reconnect(connectEventStream);
+    };
+  }
+
+  connectWebSocket();
+  console.log("HMR enabled");
+})();
@@ -0,0 +1,136 @@
+package goserve
+
+import (
+	"io/fs"
+	"os"
+	fp "path/filepath"
+
+	"github.com/ncpa0cpl/static-server/utils"
+)
+
+// createFileMessage creates a HMR message for the file under the
+// given name in the filesystem, with the file metadata filled in if
+// the file still exists. The etag is computed for the files that fit
+// in the cache.
+func createFileMessage(msgType string, msgPath string, fsys fs.FS, name string, cache *Cache) *utils.HmrMessage {
+	msg := &utils.HmrMessage{
+		Type: msgType,
+		Path: msgPath,
+	}
+
+	info, err := fs.Stat(fsys, name)
+	if err != nil || info.IsDir() {
+		return msg
+	}
+
+	msg.Mtime = info.ModTime().UnixMilli()
+	msg.Size = info.Size()
+
+	// avoid reading large files only to compute the etag
+	if cache.IsWithinFileLimit(msg.Size) {
+		content, err := fs.ReadFile(fsys, name)
+		if err == nil {
+			msg.Etag = utils.HashBytes(content)
+		}
+	}
+
+	return msg
+}
+
+// broadcastFileEvents sends the events to the HMR clients, as a single
+// batch message, along with the messages for the pages depending on
+// the changed files.
+//
+// The roots map the namespaces of the extra watched directories to
+// their absolute paths. The paths of the served files are sent relative
+// to the server root, prefixed with the url the files are mounted under.
+func (r *FileRoutes) broadcastFileEvents(roots map[string]string, events []utils.WatchEvent) {
+	batch := &utils.HmrMessage{
+		Type:   utils.HmrBatch,
+		Batch:  r.owner.nextBatchId(),
+		Events: make([]*utils.HmrMessage, 0, len(events)),
+	}
+
+	dependents := make([]*utils.HmrMessage, 0)
+	for _, event := range events {
+		if event.Root != "" {
+			rootDir := roots[event.Root]
+			relPath, _ := fp.Rel(rootDir, event.Path)
+			msg := createFileMessage(event.Op, relPath, os.DirFS(rootDir), fp.ToSlash(relPath), r.cache)
+			if event.OldPath != "" {
+				msg.OldPath, _ = fp.Rel(rootDir, event.OldPath)
+			}
+			msg.Root = event.Root
+			msg.Batch = batch.Batch
+			batch.Events = append(batch.Events, msg)
+			continue
+		}
+
+		for _, event := range r.mergedEvents(event) {
+			msg := createFileMessage(event.Op, r.servedPath(event.Path), r.overlay, event.Path, r.cache)
+			if event.OldPath != "" {
+				msg.OldPath = r.servedPath(event.OldPath)
+			}
+			msg.Batch = batch.Batch
+			batch.Events = append(batch.Events, msg)
+
+			if msg.Type == utils.HmrChanged || msg.Type == utils.HmrDeleted {
+				dependents = append(dependents, r.owner.dependencies.DependentsMessages(msg)...)
+			}
+		}
+	}
+	if len(batch.Events) == 0 {
+		// only the shadowed files have changed
+		return
+	}
+	batch.Events = append(batch.Events, dependents...)
+
+	// the clients hide the error overlay on any file change
+	r.owner.buildErrors.Reset()
+
+	if len(batch.Events) == 1 {
+		r.owner.clients.SendToAll(batch.Events[0])
+	} else {
+		r.owner.clients.SendToAll(batch)
+	}
+}
+
+// mergedEvents maps the event of a file in one of the served
+// directories to the changes of the merged view of the layers, with
+// the paths relative to the root. The events of the files shadowed
+// by the ones in earlier layers are dropped, and a file created over,
+// or deleted from over, a file in a later layer is reported as changed.
+func (r *FileRoutes) mergedEvents(event utils.WatchEvent) []utils.WatchEvent {
+	if event.Op == utils.HmrRenamed {
+		deleted := r.mergedEvents(utils.WatchEvent{Op: utils.HmrDeleted, Path: event.OldPath})
+		created := r.mergedEvents(utils.WatchEvent{Op: utils.HmrCreated, Path: event.Path})
+		if len(deleted) == 1 && deleted[0].Op == utils.HmrDeleted &&
+			len(created) == 1 && created[0].Op == utils.HmrCreated {
+			return []utils.WatchEvent{{Op: utils.HmrRenamed, Path: created[0].Path, OldPath: deleted[0].Path}}
+		}
+		return append(deleted, created...)
+	}
+
+	layer, relPath := r.overlay.LayerOf(event.Path)
+	if layer == -1 {
+		return nil
+	}
+	merged := utils.WatchEvent{Op: event.Op, Path: relPath}
+
+	_, found := r.overlay.Find(relPath, 0)
+	if found != -1 && found < layer {
+		return nil
+	}
+
+	switch event.Op {
+	case utils.HmrCreated:
+		if _, below := r.overlay.Find(relPath, layer+1); below != -1 {
+			merged.Op = utils.HmrChanged
+		}
+	case utils.HmrDeleted:
+		if found > layer {
+			merged.Op = utils.HmrChanged
+		}
+	}
+	return []utils.WatchEvent{merged}
+}
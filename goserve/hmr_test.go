@@ -0,0 +1,113 @@
+package goserve
+
+import (
+	"os"
+	fp "path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ncpa0cpl/static-server/utils"
+)
+
+func TestMergedEvents(t *testing.T) {
+	tests := []struct {
+		name string
+		// files existing in the public and dist directories after the change
+		public []string
+		dist   []string
+		event  utils.WatchEvent
+		want   []utils.WatchEvent
+	}{
+		{
+			name:   "change in the first layer",
+			public: []string{"a.js"},
+			event:  utils.WatchEvent{Op: utils.HmrChanged, Path: "public/a.js"},
+			want:   []utils.WatchEvent{{Op: utils.HmrChanged, Path: "a.js"}},
+		},
+		{
+			name:  "change in the fallback layer",
+			dist:  []string{"lib/b.js"},
+			event: utils.WatchEvent{Op: utils.HmrChanged, Path: "dist/lib/b.js"},
+			want:  []utils.WatchEvent{{Op: utils.HmrChanged, Path: "lib/b.js"}},
+		},
+		{
+			name:   "change of a shadowed file",
+			public: []string{"a.js"},
+			dist:   []string{"a.js"},
+			event:  utils.WatchEvent{Op: utils.HmrChanged, Path: "dist/a.js"},
+			want:   nil,
+		},
+		{
+			name:   "created over a fallback file",
+			public: []string{"a.js"},
+			dist:   []string{"a.js"},
+			event:  utils.WatchEvent{Op: utils.HmrCreated, Path: "public/a.js"},
+			want:   []utils.WatchEvent{{Op: utils.HmrChanged, Path: "a.js"}},
+		},
+		{
+			name:  "deleted over a fallback file",
+			dist:  []string{"a.js"},
+			event: utils.WatchEvent{Op: utils.HmrDeleted, Path: "public/a.js"},
+			want:  []utils.WatchEvent{{Op: utils.HmrChanged, Path: "a.js"}},
+		},
+		{
+			name:  "deleted from the last layer",
+			event: utils.WatchEvent{Op: utils.HmrDeleted, Path: "dist/a.js"},
+			want:  []utils.WatchEvent{{Op: utils.HmrDeleted, Path: "a.js"}},
+		},
+		{
+			name:   "renamed within a layer",
+			public: []string{"b.js"},
+			event:  utils.WatchEvent{Op: utils.HmrRenamed, Path: "public/b.js", OldPath: "public/a.js"},
+			want:   []utils.WatchEvent{{Op: utils.HmrRenamed, Path: "b.js", OldPath: "a.js"}},
+		},
+		{
+			name:   "renamed away from a fallback file",
+			public: []string{"b.js"},
+			dist:   []string{"a.js"},
+			event:  utils.WatchEvent{Op: utils.HmrRenamed, Path: "public/b.js", OldPath: "public/a.js"},
+			want: []utils.WatchEvent{
+				{Op: utils.HmrChanged, Path: "a.js"},
+				{Op: utils.HmrCreated, Path: "b.js"},
+			},
+		},
+		{
+			name:  "outside of the layers",
+			event: utils.WatchEvent{Op: utils.HmrChanged, Path: "src/a.js"},
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for dir, files := range map[string][]string{"public": tt.public, "dist": tt.dist} {
+				os.MkdirAll(fp.Join(root, dir), 0755)
+				for _, file := range files {
+					path := fp.Join(root, dir, fp.FromSlash(file))
+					os.MkdirAll(fp.Dir(path), 0755)
+					if err := os.WriteFile(path, []byte(file), 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			routes := &FileRoutes{
+				overlay: utils.CreateOverlay(
+					utils.DirLayer(fp.Join(root, "public")),
+					utils.DirLayer(fp.Join(root, "dist")),
+				),
+			}
+			event := tt.event
+			event.Path = fp.Join(root, fp.FromSlash(event.Path))
+			if event.OldPath != "" {
+				event.OldPath = fp.Join(root, fp.FromSlash(event.OldPath))
+			}
+
+			got := routes.mergedEvents(event)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergedEvents() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
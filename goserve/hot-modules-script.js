@@ -0,0 +1,233 @@
+(function () {
+  /**
+   * @typedef {{
+   *   id: string,
+   *   url?: string,
+   *   data: object,
+   *   importers: Set<string>,
+   *   deps: Set<string>,
+   *   selfAccept?: (module: object) => void,
+   *   depAccepts: Map<string, { ids: string[], single: boolean, callback?: Function }>,
+   *   disposers: Array<(data: object) => void>,
+   * }} HotModule
+   */
+
+  /**
+   * The modules served with the `import.meta.hot` context, by path.
+   * @type {Map<string, HotModule>}
+   */
+  const modules = new Map();
+
+  function moduleId(url) {
+    return decodeURIComponent(new URL(url, location.href).pathname);
+  }
+
+  function getModule(id) {
+    let mod = modules.get(id);
+    if (!mod) {
+      mod = {
+        id,
+        data: {},
+        importers: new Set(),
+        deps: new Set(),
+        depAccepts: new Map(),
+        disposers: [],
+      };
+      modules.set(id, mod);
+    }
+    return mod;
+  }
+
+  class HotContext {
+    /** @param {HotModule} mod */
+    constructor(mod) {
+      this._mod = mod;
+    }
+
+    /**
+     * Object persisted between the executions of the module,
+     * filled by the `dispose` callbacks.
+     */
+    get data() {
+      return this._mod.data;
+    }
+
+    /**
+     * Accept the updates of this module, or of the given dependencies.
+     * The callback receives the new module, or for an array of
+     * dependencies, an array with the new module at the index of
+     * the updated one.
+     *
+     * @param {string | string[] | Function} [deps]
+     * @param {Function} [callback]
+     */
+    accept(deps, callback) {
+      if (deps === undefined || typeof deps === "function") {
+        this._mod.selfAccept = deps || (() => {});
+        return;
+      }
+      const entry = {
+        ids: [].concat(deps).map((dep) => moduleId(new URL(dep, this._mod.url))),
+        single: typeof deps === "string",
+        callback,
+      };
+      for (const id of entry.ids) {
+        this._mod.depAccepts.set(id, entry);
+      }
+    }
+
+    /**
+     * Called before the module is replaced by its new version,
+     * with the `data` object passed to the new one.
+     *
+     * @param {(data: object) => void} callback
+     */
+    dispose(callback) {
+      this._mod.disposers.push(callback);
+    }
+  }
+
+  /**
+   * Creates the `import.meta.hot` context of a module, called by the
+   * code the server adds to the served modules.
+   *
+   * @param {string} url `import.meta.url` of the module
+   * @param {string[]} deps the local modules it imports
+   */
+  HMR.createHotContext = function (url, deps) {
+    const mod = getModule(moduleId(url));
+    mod.url = url;
+
+    // a new execution of the module registers its callbacks again
+    mod.selfAccept = undefined;
+    mod.depAccepts = new Map();
+    mod.disposers = [];
+
+    for (const dep of mod.deps) {
+      getModule(dep).importers.delete(mod.id);
+    }
+    mod.deps = new Set(deps.map((dep) => moduleId(new URL(dep, url))));
+    for (const dep of mod.deps) {
+      getModule(dep).importers.add(mod.id);
+    }
+
+    return new HotContext(mod);
+  };
+
+  /**
+   * Whether the file is a module executed with a hot context,
+   * the changes of which are handled without reloading the page.
+   */
+  HMR.isHotModule = function (file) {
+    const mod = modules.get("/" + file);
+    return mod !== undefined && mod.url !== undefined;
+  };
+
+  /**
+   * Finds the modules accepting the update of the module, walking
+   * up its importers. Returns false if the update reaches a module
+   * that isn't imported by any other and doesn't accept it.
+   */
+  function propagate(id, update, visited) {
+    if (visited.has(id)) {
+      return true;
+    }
+    visited.add(id);
+
+    const mod = modules.get(id);
+    if (!mod || !mod.url) {
+      return false;
+    }
+    update.stale.add(mod);
+
+    if (mod.selfAccept) {
+      addBoundary(update, mod, mod.selfAccept);
+      return true;
+    }
+    if (mod.importers.size === 0) {
+      return false;
+    }
+
+    for (const importerId of mod.importers) {
+      const importer = modules.get(importerId);
+      const entry = importer && importer.depAccepts.get(id);
+      if (entry) {
+        addBoundary(update, mod, (newModule) => {
+          if (entry.callback) {
+            entry.callback(
+              entry.single
+                ? newModule
+                : entry.ids.map((dep) => (dep === id ? newModule : undefined))
+            );
+          }
+        });
+      } else if (!propagate(importerId, update, visited)) {
+        return false;
+      }
+    }
+    return true;
+  }
+
+  function addBoundary(update, mod, callback) {
+    let callbacks = update.boundaries.get(mod);
+    if (!callbacks) {
+      callbacks = [];
+      update.boundaries.set(mod, callbacks);
+    }
+    callbacks.push(callback);
+  }
+
+  async function applyUpdate(ids) {
+    const update = { boundaries: new Map(), stale: new Set() };
+    const visited = new Set();
+    for (const id of ids) {
+      if (!propagate(id, update, visited)) {
+        console.log(`Module ${id} changed, reloading...`);
+        location.reload();
+        return;
+      }
+    }
+
+    // the callbacks of the current executions are replaced
+    // once the new ones are imported
+    for (const mod of update.stale) {
+      for (const dispose of mod.disposers) {
+        dispose(mod.data);
+      }
+      mod.disposers = [];
+    }
+
+    const timestamp = Date.now();
+    for (const [mod, callbacks] of update.boundaries) {
+      try {
+        const url = new URL(mod.url);
+        url.searchParams.set("t", String(timestamp));
+        const newModule = await import(url.href);
+        for (const callback of callbacks) {
+          callback(newModule);
+        }
+        console.log(`Module ${mod.id} updated`);
+      } catch (err) {
+        console.error(`Failed to update module ${mod.id}:`, err);
+      }
+    }
+  }
+
+  let pending = new Set();
+  let updating = Promise.resolve();
+
+  HMR.onChange((ev) => {
+    if (ev.root || !HMR.isHotModule(ev.file)) {
+      return;
+    }
+    if (pending.size === 0) {
+      // the changes of one batch are applied together
+      setTimeout(() => {
+        const ids = [...pending];
+        pending = new Set();
+        updating = updating.then(() => applyUpdate(ids));
+      });
+    }
+    pending.add("/" + ev.file);
+  });
+})();
@@ -0,0 +1,262 @@
+package goserve
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"path"
+	fp "path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncpa0cpl/static-server/utils"
+)
+
+type moduleInfo struct {
+	// index of the layer the module is read from
+	layer   int
+	modTime time.Time
+	size    int64
+	// paths of the local modules imported by this one,
+	// relative to the root
+	imports []string
+}
+
+// ModuleGraph keeps track of the imports of the served JavaScript
+// modules, used to version the import URLs. The version of a module
+// changes whenever it or any of the modules it imports (directly or
+// not) changes, so the browser re-executes the whole chain of modules
+// leading to a changed one, and reuses all the others.
+type ModuleGraph struct {
+	mutex   *sync.Mutex
+	modules map[string]*moduleInfo
+}
+
+func CreateModuleGraph() *ModuleGraph {
+	return &ModuleGraph{
+		mutex:   &sync.Mutex{},
+		modules: make(map[string]*moduleInfo),
+	}
+}
+
+func isModuleFile(path string) bool {
+	ext := fp.Ext(path)
+	return ext == ".js" || ext == ".mjs"
+}
+
+// moduleRoot is the url prefix the modules are served under,
+// and the layers they are looked up in.
+type moduleRoot struct {
+	url     string
+	overlay *utils.Overlay
+}
+
+// resolveSpecifier returns the path, relative to the root, of the
+// file the local import specifier points to, or an empty string if
+// it's outside the root.
+func resolveSpecifier(spec string, importer string, root moduleRoot) string {
+	spec, _, _ = strings.Cut(spec, "?")
+	spec, _, _ = strings.Cut(spec, "#")
+	if unescaped, err := url.PathUnescape(spec); err == nil {
+		spec = unescaped
+	}
+	var relPath string
+	if strings.HasPrefix(spec, "/") {
+		var ok bool
+		relPath, ok = strings.CutPrefix(spec, root.url)
+		if !ok {
+			return ""
+		}
+		relPath = path.Clean("/" + relPath)[1:]
+	} else {
+		relPath = path.Join(path.Dir(importer), spec)
+	}
+	if relPath == ".." || strings.HasPrefix(relPath, "../") {
+		return ""
+	}
+	return relPath
+}
+
+// info returns the up to date information about the file under the
+// path relative to the root, or nil if it doesn't exist.
+func (g *ModuleGraph) info(relPath string, root moduleRoot) *moduleInfo {
+	if relPath == "" {
+		return nil
+	}
+	stat, layer := root.overlay.Find(relPath, 0)
+	if layer == -1 {
+		return nil
+	}
+
+	// the absolute imports resolve differently under each url
+	key := root.url + "\x00" + relPath
+
+	g.mutex.Lock()
+	cached, ok := g.modules[key]
+	g.mutex.Unlock()
+	if ok && cached.layer == layer && cached.modTime.Equal(stat.ModTime()) && cached.size == stat.Size() {
+		return cached
+	}
+
+	info := &moduleInfo{
+		layer:   layer,
+		modTime: stat.ModTime(),
+		size:    stat.Size(),
+	}
+	if isModuleFile(relPath) {
+		content, _, err := root.overlay.ReadFile(layer, relPath)
+		if err == nil {
+			specifiers, _ := utils.FindImportSpecifiers(content)
+			for _, spec := range specifiers {
+				if spec.IsLocal() {
+					info.imports = append(info.imports, resolveSpecifier(spec.Value, relPath, root))
+				}
+			}
+		}
+	}
+
+	g.mutex.Lock()
+	g.modules[key] = info
+	g.mutex.Unlock()
+	return info
+}
+
+// Version returns the version of the module, computed from the
+// modification times of all the files it depends on, or an empty
+// string if the file doesn't exist. The path is relative to the root.
+func (g *ModuleGraph) Version(path string, root moduleRoot) string {
+	info := g.info(path, root)
+	if info == nil {
+		return ""
+	}
+
+	// the set of reachable files is hashed rather than the versions
+	// of the imports, which handles import cycles
+	visited := map[string]*moduleInfo{path: info}
+	queue := []*moduleInfo{info}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, imported := range current.imports {
+			if _, ok := visited[imported]; ok {
+				continue
+			}
+			importedInfo := g.info(imported, root)
+			visited[imported] = importedInfo
+			if importedInfo != nil {
+				queue = append(queue, importedInfo)
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(visited))
+	for p := range visited {
+		paths = append(paths, p)
+	}
+	slices.Sort(paths)
+
+	buff := bytes.Buffer{}
+	for _, p := range paths {
+		buff.WriteString(p)
+		if info := visited[p]; info != nil {
+			// a module taken from another layer is a new version
+			buff.WriteString(strconv.Itoa(info.layer))
+			buff.WriteString(strconv.FormatInt(info.modTime.UnixNano(), 36))
+			buff.WriteString(strconv.FormatInt(info.size, 36))
+		}
+		buff.WriteByte(0)
+	}
+	return utils.HashBytes(buff.Bytes())
+}
+
+// RewriteModule adds the version query parameter to the local import
+// specifiers of the module and prepends the creation of its
+// `import.meta.hot` context. Sources that don't use the ES module syntax
+// are returned unchanged, since classic scripts cannot import modules
+// statically. The prelude is added on the first line, so that the line
+// numbers in the source maps remain valid. The path of the module is
+// relative to the root. Without the hot context only the imports
+// are rewritten, for the modules loaded by workers, which have no
+// HMR client.
+func (g *ModuleGraph) RewriteModule(content []byte, path string, root moduleRoot, hotContext bool) []byte {
+	specifiers, isModule := utils.FindImportSpecifiers(content)
+	if !isModule {
+		return content
+	}
+
+	deps := []string{}
+	result := make([]byte, 0, len(content)+256)
+
+	prev := 0
+	rewritten := []byte{}
+	for _, spec := range specifiers {
+		if !spec.IsLocal() {
+			continue
+		}
+		version := g.Version(resolveSpecifier(spec.Value, path, root), root)
+		if version == "" {
+			continue
+		}
+		deps = append(deps, spec.Value)
+
+		separator := "?"
+		if strings.Contains(spec.Value, "?") {
+			separator = "&"
+		}
+		rewritten = append(rewritten, content[prev:spec.End]...)
+		rewritten = append(rewritten, separator+"v="+version...)
+		prev = spec.End
+	}
+	rewritten = append(rewritten, content[prev:]...)
+	if !hotContext {
+		return rewritten
+	}
+
+	depsJson, _ := json.Marshal(deps)
+	result = append(result, `import { HMR as __serve_hmr } from "`+HmrModulePath+`";`...)
+	result = append(result, "import.meta.hot = __serve_hmr.createHotContext(import.meta.url, "...)
+	result = append(result, depsJson...)
+	result = append(result, ");"...)
+	return append(result, rewritten...)
+}
+
+// isWorkerRequest reports whether the script is loaded by a worker,
+// including the modules imported by it.
+func isWorkerRequest(c echo.Context) bool {
+	switch c.Request().Header.Get("Sec-Fetch-Dest") {
+	case "worker", "sharedworker", "serviceworker":
+		return true
+	}
+	return false
+}
+
+// sendModule sends the JavaScript file with its imports rewritten,
+// the version of the imports can change while the file doesn't, so
+// it is revalidated with the ETag of the rewritten content only.
+func (r *FileRoutes) sendModule(file *StaticFile, c echo.Context, conf *Configuration) error {
+	root := moduleRoot{
+		url:     "/" + strings.TrimSuffix(file.ServedPath, file.RelPath),
+		overlay: file.overlay,
+	}
+	content := r.owner.hotModules.RewriteModule(file.GetContent(), file.RelPath, root, !isWorkerRequest(c))
+	etag := file.Etag
+	if len(content) != file.Length() {
+		etag = utils.HashBytes(content)
+	}
+	// the pages and the workers get different content
+	c.Response().Header().Add("Vary", "Sec-Fetch-Dest")
+
+	if !conf.ExcludeEtag {
+		if c.Request().Header.Get("If-None-Match") == etag {
+			c.Logger().Debug("Resource not modified, returning 304")
+			return c.NoContent(304)
+		}
+		c.Response().Header().Set("ETag", etag)
+	}
+
+	return c.Blob(200, file.ContentType, content)
+}
@@ -0,0 +1,92 @@
+package goserve
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/ncpa0cpl/static-server/utils"
+)
+
+func TestResolveSpecifier(t *testing.T) {
+	root := moduleRoot{url: "/static"}
+	tests := []struct {
+		spec     string
+		importer string
+		want     string
+	}{
+		{"./b.js", "js/a.js", "js/b.js"},
+		{"../lib/b.js", "js/a.js", "lib/b.js"},
+		{"./b.js?raw#x", "a.js", "b.js"},
+		{"./my%20file.js", "a.js", "my file.js"},
+		{"/static/js/b.js", "a.js", "js/b.js"},
+		{"/static/../b.js", "a.js", "b.js"},
+		{"/other/b.js", "a.js", ""},
+		{"../../b.js", "js/a.js", ""},
+	}
+	for _, tt := range tests {
+		if got := resolveSpecifier(tt.spec, tt.importer, root); got != tt.want {
+			t.Errorf("resolveSpecifier(%q, %q) = %q, want %q", tt.spec, tt.importer, got, tt.want)
+		}
+	}
+}
+
+func TestRewriteModule(t *testing.T) {
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"main.js":     {Data: []byte("import { a } from \"./a.js\";\nimport x from 'pkg';\nimport('./lazy.js?x=1');"), ModTime: modTime},
+		"a.js":        {Data: []byte("import { b } from '/b.js';\nexport const a = b;"), ModTime: modTime},
+		"b.js":        {Data: []byte("export const b = 1;"), ModTime: modTime},
+		"lazy.js":     {Data: []byte("export default 1;"), ModTime: modTime},
+		"classic.js":  {Data: []byte("console.log('./a.js');"), ModTime: modTime},
+		"dangling.js": {Data: []byte("import './missing.js';"), ModTime: modTime},
+	}
+	graph := CreateModuleGraph()
+	root := moduleRoot{url: "", overlay: utils.CreateOverlay(utils.Layer{FS: fsys})}
+	rewrite := func(name string, hotContext bool) string {
+		return string(graph.RewriteModule(fsys[name].Data, name, root, hotContext))
+	}
+
+	aVersion := graph.Version("a.js", root)
+	lazyVersion := graph.Version("lazy.js", root)
+	if aVersion == "" || aVersion == lazyVersion {
+		t.Fatalf("Version() = %q, %q", aVersion, lazyVersion)
+	}
+
+	got := rewrite("main.js", true)
+	lines := strings.Split(got, "\n")
+	if len(lines) != 3 {
+		t.Fatalf("RewriteModule() changed the number of lines: %q", got)
+	}
+	prelude := `import { HMR as __serve_hmr } from "` + HmrModulePath + `";` +
+		`import.meta.hot = __serve_hmr.createHotContext(import.meta.url, ["./a.js","./lazy.js?x=1"]);`
+	if want := prelude + `import { a } from "./a.js?v=` + aVersion + `";`; lines[0] != want {
+		t.Errorf("first line = %q, want %q", lines[0], want)
+	}
+	if want := "import x from 'pkg';"; lines[1] != want {
+		t.Errorf("bare import = %q, want %q", lines[1], want)
+	}
+	if want := "import('./lazy.js?x=1&v=" + lazyVersion + "');"; lines[2] != want {
+		t.Errorf("dynamic import = %q, want %q", lines[2], want)
+	}
+
+	if got := rewrite("main.js", false); strings.Contains(got, "__serve_hmr") || !strings.Contains(got, "./a.js?v="+aVersion) {
+		t.Errorf("RewriteModule() without the hot context = %q", got)
+	}
+	if got := rewrite("classic.js", true); got != string(fsys["classic.js"].Data) {
+		t.Errorf("RewriteModule() changed a classic script: %q", got)
+	}
+	if got := rewrite("dangling.js", false); got != string(fsys["dangling.js"].Data) {
+		t.Errorf("RewriteModule() versioned a missing module: %q", got)
+	}
+
+	// a change of an indirect import changes the version
+	fsys["b.js"] = &fstest.MapFile{Data: []byte("export const b = 2;"), ModTime: modTime.Add(time.Second)}
+	if graph.Version("a.js", root) == aVersion {
+		t.Error("Version() did not change with an imported module")
+	}
+	if graph.Version("lazy.js", root) != lazyVersion {
+		t.Error("Version() changed without a change of the module")
+	}
+}
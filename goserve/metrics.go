@@ -0,0 +1,193 @@
+package goserve
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncpa0cpl/static-server/utils"
+)
+
+// upper bounds (in seconds) of the request latency histogram buckets
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type requestKey struct {
+	method string
+	status int
+}
+
+type Metrics struct {
+	mutex *sync.Mutex
+
+	requests      map[requestKey]uint64
+	latencyCounts []uint64
+	latencySum    float64
+	latencyCount  uint64
+	bytesServed   uint64
+	watcherEvents map[string]uint64
+	// caches of the mounted directories, by url prefix
+	caches map[string]*Cache
+	// counted in the HMR connections metric
+	clients *utils.WsController
+}
+
+func CreateMetrics(clients *utils.WsController) *Metrics {
+	return &Metrics{
+		mutex:         &sync.Mutex{},
+		clients:       clients,
+		requests:      make(map[requestKey]uint64),
+		latencyCounts: make([]uint64, len(latencyBuckets)),
+		watcherEvents: make(map[string]uint64),
+		caches:        make(map[string]*Cache),
+	}
+}
+
+// AddCache includes the statistics of the cache in the metrics,
+// labeled with the url prefix of the mount it belongs to.
+func (m *Metrics) AddCache(mount string, cache *Cache) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.caches[mount] = cache
+}
+
+func (m *Metrics) ObserveRequest(method string, status int, latency time.Duration, size int64) {
+	seconds := latency.Seconds()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.requests[requestKey{method, status}]++
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			m.latencyCounts[i]++
+		}
+	}
+	m.latencySum += seconds
+	m.latencyCount++
+	if size > 0 {
+		m.bytesServed += uint64(size)
+	}
+}
+
+func (m *Metrics) CountWatcherEvent(op string) {
+	m.mutex.Lock()
+	m.watcherEvents[op]++
+	m.mutex.Unlock()
+}
+
+func (m *Metrics) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
+
+			res := c.Response()
+			m.ObserveRequest(c.Request().Method, res.Status, time.Since(start), res.Size)
+
+			return nil
+		}
+	}
+}
+
+// Handler serves the collected metrics in the Prometheus text format.
+func (m *Metrics) Handler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		b := &strings.Builder{}
+		m.write(b)
+		return c.Blob(200, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+	}
+}
+
+func (m *Metrics) write(w io.Writer) {
+	m.mutex.Lock()
+
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].status < keys[j].status
+	})
+
+	writeHeader(w, "goserve_http_requests_total", "counter", "Number of handled HTTP requests.")
+	for _, k := range keys {
+		fmt.Fprintf(w, "goserve_http_requests_total{method=%q,status=\"%d\"} %d\n", k.method, k.status, m.requests[k])
+	}
+
+	writeHeader(w, "goserve_http_request_duration_seconds", "histogram", "Latency of handled HTTP requests.")
+	for i, bound := range latencyBuckets {
+		fmt.Fprintf(
+			w, "goserve_http_request_duration_seconds_bucket{le=\"%s\"} %d\n",
+			strconv.FormatFloat(bound, 'f', -1, 64), m.latencyCounts[i],
+		)
+	}
+	fmt.Fprintf(w, "goserve_http_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.latencyCount)
+	fmt.Fprintf(w, "goserve_http_request_duration_seconds_sum %s\n", strconv.FormatFloat(m.latencySum, 'f', -1, 64))
+	fmt.Fprintf(w, "goserve_http_request_duration_seconds_count %d\n", m.latencyCount)
+
+	writeHeader(w, "goserve_http_response_bytes_total", "counter", "Number of bytes sent in response bodies.")
+	fmt.Fprintf(w, "goserve_http_response_bytes_total %d\n", m.bytesServed)
+
+	ops := make([]string, 0, len(m.watcherEvents))
+	for op := range m.watcherEvents {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+
+	writeHeader(w, "goserve_watcher_events_total", "counter", "Number of file system events received by the watcher.")
+	for _, op := range ops {
+		fmt.Fprintf(w, "goserve_watcher_events_total{op=%q} %d\n", op, m.watcherEvents[op])
+	}
+
+	mounts := make([]string, 0, len(m.caches))
+	for mount := range m.caches {
+		mounts = append(mounts, mount)
+	}
+	sort.Strings(mounts)
+	caches := make([]*Cache, len(mounts))
+	for i, mount := range mounts {
+		caches[i] = m.caches[mount]
+	}
+
+	m.mutex.Unlock()
+
+	cacheMetric := func(name, kind, help string, value func(c *Cache) uint64) {
+		writeHeader(w, name, kind, help)
+		for i, mount := range mounts {
+			fmt.Fprintf(w, "%s{mount=%q} %d\n", name, mount, value(caches[i]))
+		}
+	}
+	cacheMetric("goserve_cache_size_bytes", "gauge", "Size of all files currently in the cache.",
+		func(c *Cache) uint64 { return c.CalcSize() })
+	cacheMetric("goserve_cache_max_size_bytes", "gauge", "Maximum size of all files in the cache.",
+		func(c *Cache) uint64 { return c.MaxSize() })
+	cacheMetric("goserve_cache_entries", "gauge", "Number of files currently in the cache.",
+		func(c *Cache) uint64 { return uint64(c.Count()) })
+	cacheMetric("goserve_cache_hits_total", "counter", "Number of requests served from the cache.",
+		func(c *Cache) uint64 { return c.hits.Load() })
+	cacheMetric("goserve_cache_misses_total", "counter", "Number of cache lookups that did not find the file.",
+		func(c *Cache) uint64 { return c.misses.Load() })
+	cacheMetric("goserve_cache_evictions_total", "counter", "Number of files removed from the cache.",
+		func(c *Cache) uint64 { return c.evictions.Load() })
+	cacheMetric("goserve_cache_revalidations_total", "counter", "Number of cached files reloaded after a change on disk.",
+		func(c *Cache) uint64 { return c.revalidations.Load() })
+
+	writeHeader(w, "goserve_hmr_connections", "gauge", "Number of connected HMR clients, over WebSocket or Server-Sent Events.")
+	fmt.Fprintf(w, "goserve_hmr_connections %d\n", m.clients.Count())
+}
+
+func writeHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
@@ -1,4 +1,4 @@
-package main
+package goserve
 
 import (
 	_ "embed"
@@ -0,0 +1,1117 @@
+package goserve
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	fp "path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/ncpa0cpl/convenient-structures"
+	"github.com/ncpa0cpl/static-server/utils"
+)
+
+type StaticFile struct {
+	// location of the file, its path on the disk if it's not
+	// served from an archive or another filesystem
+	Path    string
+	RelPath string
+	// path of the file relative to the server root, including the url
+	// prefix of its mount, the file is identified by it in the HMR
+	// messages
+	ServedPath        string
+	content           []byte
+	ContentType       string
+	LastModifiedAt    *time.Time
+	LastModifiedAtRFC string
+	Etag              string
+	Config            *Configuration
+	// layers the file is looked up in, it's read again
+	// when it starts being taken from a different one
+	overlay *utils.Overlay
+	layer   int
+}
+
+func (f *StaticFile) Length() int {
+	return len(f.content)
+}
+
+func (f *StaticFile) GetContent() []byte {
+	// return the copy of the byte slice to avoid problems
+	// that could be caused by the user mutating the array
+	buff := make([]byte, len(f.content))
+	copy(buff, f.content)
+	return buff
+}
+
+type Cache struct {
+	maxSize     uint64
+	maxFileSize uint64
+
+	files       *Array[*StaticFile]
+	currentSize uint64
+	mutex       *sync.RWMutex
+
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	revalidations atomic.Uint64
+	evictions     atomic.Uint64
+}
+
+// SetLimits sets the cache limits, both given in megabytes.
+func (c *Cache) SetLimits(maxSize, maxFileSize uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.maxSize = maxSize * 1024 * 1024         // MB * KB * B = B
+	c.maxFileSize = maxFileSize * 1024 * 1024 // MB * KB * B = B
+}
+
+func (c *Cache) CalcSize() uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.calcSize()
+}
+
+func (c *Cache) calcSize() uint64 {
+	size := uint64(0)
+	iter := c.files.Iterator()
+	for !iter.Done() {
+		file, _ := iter.Next()
+		size += uint64(file.Length())
+	}
+	c.currentSize = size
+	return size
+}
+
+func (c *Cache) CalcSizeMb() uint64 {
+	bytesLen := c.CalcSize()
+	return bytesLen / 1024 / 1024
+}
+
+func (c *Cache) Push(file *StaticFile) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	fsize := uint64(file.Length())
+	if fsize > c.maxFileSize {
+		return false
+	}
+	if c.currentSize+fsize > c.maxSize {
+		return false
+	}
+	c.currentSize += fsize
+	c.files.Push(file)
+	return true
+}
+
+// Find returns the cached file with the given relative path
+// and records a cache hit or miss.
+func (c *Cache) Find(relPath string) *StaticFile {
+	file := c.Peek(relPath)
+	if file == nil {
+		c.misses.Add(1)
+		return nil
+	}
+	c.hits.Add(1)
+	return file
+}
+
+// Peek returns the cached file with the given relative path
+// without recording a cache hit or miss.
+func (c *Cache) Peek(relPath string) *StaticFile {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	_, file := c.files.Find(func(f *StaticFile, _ int) bool {
+		return f.RelPath == relPath
+	})
+	return file
+}
+
+// Remove drops the file from the cache, returns false if
+// the file was not in the cache.
+func (c *Cache) Remove(file *StaticFile) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	idx := IndexOf(c.files, file)
+	if idx == -1 {
+		return false
+	}
+	c.files.Splice(idx, idx+1)
+	c.calcSize()
+	c.evictions.Add(1)
+	return true
+}
+
+// Replace swaps the cached file with its new version, returns false
+// if the file is no longer in the cache.
+func (c *Cache) Replace(file *StaticFile, updated *StaticFile) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	idx := IndexOf(c.files, file)
+	if idx == -1 {
+		return false
+	}
+	c.files.Set(idx, updated)
+	c.calcSize()
+	return true
+}
+
+// Iterator iterates over a snapshot of the cached files.
+func (c *Cache) Iterator() Iterator[*StaticFile] {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.files.Copy().Iterator()
+}
+
+func (c *Cache) Clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.evictions.Add(uint64(c.files.Length()))
+	c.files = &Array[*StaticFile]{}
+	c.currentSize = 0
+}
+
+func (c *Cache) Count() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.files.Length()
+}
+
+func (c *Cache) IsWithinFileLimit(size int64) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return uint64(size) <= c.maxFileSize
+}
+
+// MaxSize returns the size limit of the cache in bytes.
+func (c *Cache) MaxSize() uint64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.maxSize
+}
+
+// CreateCache creates an empty cache with the given limits,
+// both in megabytes.
+func CreateCache(maxSize, maxFileSize uint64) *Cache {
+	c := &Cache{
+		files: &Array[*StaticFile]{},
+		mutex: &sync.RWMutex{},
+	}
+	c.SetLimits(maxSize, maxFileSize)
+	return c
+}
+
+func detectContentType(filepath string, content []byte) string {
+	httpDet := http.DetectContentType(content)
+	ext := path.Ext(filepath)
+
+	if ext == ".svg" {
+		return "image/svg+xml; charset=utf-8"
+	}
+
+	if strings.HasPrefix(httpDet, "text/plain") {
+		switch ext {
+		case ".html":
+			return strings.Replace(httpDet, "text/plain", "text/html", 1)
+		case ".css":
+			return strings.Replace(httpDet, "text/plain", "text/css", 1)
+		case ".js", ".mjs", ".cjs":
+			return strings.Replace(httpDet, "text/plain", "text/javascript", 1)
+		case ".ts", ".mts", ".cts":
+			return strings.Replace(httpDet, "text/plain", "text/typescript", 1)
+		case ".json":
+			return strings.Replace(httpDet, "text/plain", "application/json", 1)
+		case ".xml":
+			return strings.Replace(httpDet, "text/plain", "application/xml", 1)
+		}
+	}
+
+	if ext != "" {
+		mappedMime := MimeTypesMap[ext[1:]]
+		if mappedMime != "" {
+			return mappedMime
+		}
+	}
+
+	return httpDet
+}
+
+// Revalidate checks if the file has changed since it was loaded, and
+// returns a new StaticFile with the current content if it has, or nil
+// if it hasn't. The file itself is not modified, since it can be in
+// use by concurrent requests.
+func (f *StaticFile) Revalidate() (*StaticFile, error) {
+	info, layer := f.overlay.Find(f.RelPath, 0)
+	if layer == -1 {
+		return nil, &fs.PathError{Op: "stat", Path: f.Path, Err: fs.ErrNotExist}
+	}
+
+	if layer == f.layer && info.ModTime().Equal(*f.LastModifiedAt) {
+		return nil, nil
+	}
+
+	buff, info, err := f.overlay.ReadFile(layer, f.RelPath)
+	if err != nil {
+		return nil, err
+	}
+	modTime := info.ModTime()
+
+	updated := *f
+	updated.Path = f.overlay.Location(layer, f.RelPath)
+	updated.layer = layer
+	if f.Config.Watcher && strings.Contains(f.ContentType, "text/html") {
+		updated.content = addMetaTags(buff, f.ServedPath, modTime)
+	} else {
+		updated.content = buff
+	}
+	updated.Etag = utils.HashBytes(buff)
+	updated.LastModifiedAt = &modTime
+	updated.LastModifiedAtRFC = modTime.Format(http.TimeFormat)
+	updated.ContentType = detectContentType(updated.Path, buff)
+
+	return &updated, nil
+}
+
+func addMetaTags(html []byte, servedPath string, modTime time.Time) []byte {
+	fname := fmt.Sprintf("  <meta name=\"_serve:fname\" content=\"%s\" />\n", servedPath)
+	mtime := fmt.Sprintf("    <meta name=\"_serve:mtime\" content=\"%d\" />\n", modTime.UnixMilli())
+	fsize := fmt.Sprintf("    <meta name=\"_serve:fsize\" content=\"%d\" />\n  ", len(html))
+
+	tags := []byte(fname + mtime + fsize)
+
+	return utils.InjectIntoHead(html, tags)
+}
+
+func getStaticFile(overlay *utils.Overlay, layer int, relPath, servedPath string) ([]byte, string, *time.Time, error) {
+	buff, info, err := overlay.ReadFile(layer, relPath)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	modTime := info.ModTime()
+	contentType := detectContentType(relPath, buff)
+
+	if strings.Contains(contentType, "text/html") {
+		buff = addMetaTags(buff, servedPath, modTime)
+	}
+
+	return buff, contentType, &modTime, err
+}
+
+type StaticResponse struct {
+	file                     *StaticFile
+	cacheMaxAge              int
+	cacheRequireRevalidation bool
+	acceptRangeRequests      bool
+	isPrivate                bool
+	sendInstead              error
+	shouldSendInstead        bool
+	contentType              string
+}
+
+func (s *StaticResponse) GetFilepath() string {
+	return s.file.Path
+}
+
+func (s *StaticResponse) GetFileContent() []byte {
+	return s.file.GetContent()
+}
+
+func (s *StaticResponse) GetContentType() string {
+	return s.file.ContentType
+}
+
+func (s *StaticResponse) GetLastModifiedAt() string {
+	return s.file.LastModifiedAtRFC
+}
+
+func (s *StaticResponse) SetCacheMaxAge(age int) {
+	s.cacheMaxAge = age
+}
+
+func (s *StaticResponse) SetNoCache(noCache bool) {
+	s.cacheRequireRevalidation = noCache
+}
+
+func (s *StaticResponse) SetAcceptRangeRequests(allow bool) {
+	s.acceptRangeRequests = allow
+}
+
+func (s *StaticResponse) SetIsPrivate(isPrivate bool) {
+	s.isPrivate = isPrivate
+}
+
+func (s *StaticResponse) SetContentType(contentType string) {
+	s.contentType = contentType
+}
+
+func (s *StaticResponse) Instead(err error) {
+	s.sendInstead = err
+	s.shouldSendInstead = true
+}
+
+func (s *StaticResponse) buildCacheControlHeader(conf *Configuration) string {
+	hvalue := ""
+
+	if s.isPrivate {
+		hvalue += "private"
+	} else {
+		hvalue += "public"
+	}
+
+	if s.cacheRequireRevalidation || conf.NoCache {
+		hvalue += ", no-cache"
+	} else if s.cacheMaxAge != 0 {
+		var maxAge int
+		if conf.MaxAge != 0 {
+			maxAge = conf.MaxAge
+		} else {
+			maxAge = s.cacheMaxAge
+		}
+		hvalue += ", must-revalidate, max-age=" + strconv.Itoa(maxAge)
+	}
+
+	return hvalue
+}
+
+// value of the CspNonce option that reuses the nonce
+// of the page instead of a fixed one
+const CspNonceAuto = "auto"
+
+type Configuration struct {
+	BeforeSend       func(*StaticResponse, echo.Context) error `json:"-"`
+	RedirectTo       string                                    `json:"redirectTo"`
+	SpaFile          string                                    `json:"spaFile"`
+	ExcludeEtag      bool                                      `json:"excludeEtag"`
+	MaxAge           int                                       `json:"maxAge"`
+	NoCache          bool                                      `json:"noCache"`
+	MaxCacheSize     uint64                                    `json:"maxCacheSize"`
+	MaxCacheFileSize uint64                                    `json:"maxCacheFileSize"`
+	Watcher          bool                                      `json:"watcher"`
+	AutoReload       bool                                      `json:"autoReload"`
+	ChunkSize        uint64                                    `json:"chunkSize"`
+	NoStreaming      bool                                      `json:"noStreaming"`
+	HotCss           bool                                      `json:"hotCss"`
+	HotModules       bool                                      `json:"hotModules"`
+	WatchDebounce    int                                       `json:"watchDebounce"`
+	WatchMode        string                                    `json:"watchMode"`
+	WatchInclude     []string                                  `json:"watchInclude"`
+	WatchIgnore      []string                                  `json:"watchIgnore"`
+	WatchExtra       []string                                  `json:"watchExtra"`
+	CspNonce         string                                    `json:"cspNonce"`
+	OnChange         string                                    `json:"onChange"`
+	Headers          map[string]string                         `json:"headers"`
+	// directories served under url prefixes, besides the main one
+	Mounts []Mount `json:"mounts"`
+}
+
+func fmtSize(size int) string {
+	if size < 1024 {
+		return strconv.Itoa(size) + "B"
+	}
+	if size < 1024*1024 {
+		return strconv.Itoa(size/1024) + "KB"
+	}
+	return strconv.Itoa(size/1024/1024) + "MB"
+}
+
+// SendFromCache sends the file with the given path, relative to the
+// root directory, if it's in the cache. The second return value
+// reports whether the file was found.
+func (r *FileRoutes) SendFromCache(c echo.Context, conf *Configuration, filepath string) (error, bool) {
+	server := r.server
+	cache := r.cache
+
+	file := cache.Find(filepath)
+	if file == nil {
+		return nil, false
+	}
+
+	updated, err := file.Revalidate()
+	if err != nil {
+		server.Logger.Errorf(
+			"Failed to revalidate file(%s): %s",
+			file.Path, err.Error(),
+		)
+		return c.String(500, "Internal server error"), true
+	}
+	if updated != nil {
+		cache.revalidations.Add(1)
+		// swap the new version in, and evict the file
+		// if it no longer fits within the cache limits
+		if !cache.IsWithinFileLimit(int64(updated.Length())) || !cache.Replace(file, updated) || cache.CalcSize() > cache.MaxSize() {
+			server.Logger.Debugf("Evicting file from cache: %s", file.RelPath)
+			cache.Remove(file)
+			cache.Remove(updated)
+		}
+		file = updated
+	}
+	c.Set(ctxCacheStatus, "hit")
+	return r.sendFile(file, c, conf), true
+}
+
+// FileRoutes holds the state of the file routes added to the server
+// by the AddFileRoutes and AddFsRoutes methods. Each one has its own
+// cache.
+type FileRoutes struct {
+	BaseUrl string
+	// directory of the first layer, empty if the files
+	// are not served from a directory on the disk
+	RootDir string
+
+	config   atomic.Pointer[Configuration]
+	overlay  *utils.Overlay
+	owner    *Server
+	server   *echo.Echo
+	cache    *Cache
+	watchers []utils.FsWatcher
+	batcher  *utils.EventBatcher
+	builder  *Builder
+}
+
+// Config returns the configuration currently in use.
+func (r *FileRoutes) Config() *Configuration {
+	return r.config.Load()
+}
+
+// Cache returns the cache of the files served by these routes.
+func (r *FileRoutes) Cache() *Cache {
+	return r.cache
+}
+
+// Sources returns the paths of the directories and archives the
+// files are served from, in the order they are looked up in.
+func (r *FileRoutes) Sources() []string {
+	sources := make([]string, len(r.overlay.Layers))
+	for i, l := range r.overlay.Layers {
+		sources[i] = l.Source
+	}
+	return sources
+}
+
+// Mount returns the url prefix the files are served under,
+// "/" for the server root.
+func (r *FileRoutes) Mount() string {
+	if r.BaseUrl == "" {
+		return "/"
+	}
+	return r.BaseUrl
+}
+
+// servedPath returns the path, relative to the server root, of
+// the file under the given path relative to the root directory.
+func (r *FileRoutes) servedPath(relPath string) string {
+	if r.BaseUrl == "" {
+		return relPath
+	}
+	return strings.TrimPrefix(r.BaseUrl, "/") + "/" + relPath
+}
+
+// loadFile reads the file under the given path relative to the
+// root, from the first layer containing it.
+func (r *FileRoutes) loadFile(relPath string, conf *Configuration) (*StaticFile, error) {
+	_, layer := r.overlay.Find(relPath, 0)
+	if layer == -1 {
+		return nil, &fs.PathError{Op: "open", Path: relPath, Err: fs.ErrNotExist}
+	}
+	servedPath := r.servedPath(relPath)
+
+	content, ctype, modTime, err := getStaticFile(r.overlay, layer, relPath, servedPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StaticFile{
+		Path:              r.overlay.Location(layer, relPath),
+		RelPath:           relPath,
+		ServedPath:        servedPath,
+		content:           content,
+		ContentType:       ctype,
+		Etag:              utils.HashBytes(content),
+		LastModifiedAt:    modTime,
+		LastModifiedAtRFC: modTime.Format(http.TimeFormat),
+		Config:            conf,
+		overlay:           r.overlay,
+		layer:             layer,
+	}, nil
+}
+
+// UpdateConfig validates the given configuration and swaps it with
+// the one currently in use. Options that cannot be changed while the
+// server is running (watcher and auto-reload) are carried over from
+// the current configuration. The cache is refilled if its limits
+// have changed.
+func (r *FileRoutes) UpdateConfig(conf *Configuration) error {
+	err := conf.Validate()
+	if err != nil {
+		return err
+	}
+
+	current := r.Config()
+
+	if changed := changedWatcherOptions(current, conf); len(changed) > 0 {
+		r.server.Logger.Warnf(
+			"The %s options cannot be changed without a restart, keeping the previous values",
+			strings.Join(changed, ", "),
+		)
+		conf.Watcher = current.Watcher
+		conf.AutoReload = current.AutoReload
+		conf.WatchDebounce = current.WatchDebounce
+		conf.WatchMode = current.WatchMode
+		conf.WatchInclude = current.WatchInclude
+		conf.WatchIgnore = current.WatchIgnore
+		conf.WatchExtra = current.WatchExtra
+		conf.OnChange = current.OnChange
+	}
+	if conf.BeforeSend == nil {
+		conf.BeforeSend = current.BeforeSend
+	}
+
+	r.config.Store(conf)
+
+	if conf.MaxCacheSize != current.MaxCacheSize || conf.MaxCacheFileSize != current.MaxCacheFileSize {
+		r.server.Logger.Debug("Cache limits changed, refilling the cache")
+		r.cache.SetLimits(conf.MaxCacheSize, conf.MaxCacheFileSize)
+		r.Rescan()
+	}
+
+	return nil
+}
+
+// changedWatcherOptions returns the names of the options used to
+// start the watchers that differ between the configurations.
+func changedWatcherOptions(current, conf *Configuration) []string {
+	changed := []string{}
+	if conf.Watcher != current.Watcher {
+		changed = append(changed, "watcher")
+	}
+	if conf.AutoReload != current.AutoReload {
+		changed = append(changed, "autoReload")
+	}
+	if conf.WatchDebounce != current.WatchDebounce {
+		changed = append(changed, "watchDebounce")
+	}
+	if conf.WatchMode != current.WatchMode {
+		changed = append(changed, "watchMode")
+	}
+	if !slices.Equal(conf.WatchInclude, current.WatchInclude) {
+		changed = append(changed, "watchInclude")
+	}
+	if !slices.Equal(conf.WatchIgnore, current.WatchIgnore) {
+		changed = append(changed, "watchIgnore")
+	}
+	if !slices.Equal(conf.WatchExtra, current.WatchExtra) {
+		changed = append(changed, "watchExtra")
+	}
+	if conf.OnChange != current.OnChange {
+		changed = append(changed, "onChange")
+	}
+	return changed
+}
+
+// Close stops the file watchers and the running build,
+// if any were started.
+func (r *FileRoutes) Close() {
+	for _, w := range r.watchers {
+		w.Close()
+	}
+	if r.batcher != nil {
+		r.batcher.Stop()
+	}
+	if r.builder != nil {
+		r.builder.Stop()
+	}
+}
+
+// Rescan drops all the files from the cache and walks the
+// layers filling the cache again.
+func (r *FileRoutes) Rescan() {
+	r.cache.Clear()
+	r.fillCache()
+}
+
+func (r *FileRoutes) fillCache() {
+	cache := r.cache
+	if cache.MaxSize() == 0 {
+		return
+	}
+
+	server := r.server
+	conf := r.Config()
+
+	// the shadowed files of the later layers are skipped
+	r.overlay.Walk(func(relativePath string, _ int) error {
+		file, err := r.loadFile(relativePath, conf)
+
+		if err == nil {
+			server.Logger.Debugf("Adding file to cache: %s", relativePath)
+
+			added := cache.Push(file)
+
+			if !added {
+				if cache.IsWithinFileLimit(int64(file.Length())) {
+					server.Logger.Debugf(
+						"Cache mem limit reached when adding file: %s (%s)",
+						relativePath,
+						fmtSize(file.Length()),
+					)
+					// stop walking the layers
+					return fmt.Errorf("unable to add file to cache")
+				}
+			}
+		}
+		return nil
+	})
+
+	server.Logger.Debugf(
+		"Current cache size (%s): %dMB",
+		r.Mount(),
+		cache.CalcSizeMb(),
+	)
+}
+
+// watchedDir is a directory watched for the changes,
+// with the namespace its events are sent under.
+type watchedDir struct {
+	namespace string
+	dir       string
+}
+
+// addHmrRoutes adds the endpoints of the HMR clients, which
+// are shared by all the file routes added by the server.
+func (s *Server) addHmrRoutes() {
+	s.hmrRoutes.Do(s.addHmrRoutesOnce)
+}
+
+func (s *Server) addHmrRoutesOnce() {
+	server := s.echo
+
+	server.GET("/__serve_hmr", func(c echo.Context) error {
+		ws, err := s.upgrader.Upgrade(c.Response(), c.Request(), nil)
+		if err != nil {
+			return err
+		}
+		client := s.clients.AddConnection(ws, c.Request())
+		s.buildErrors.sendCurrent(client)
+		return nil
+	})
+
+	// fallback for the clients that cannot open a WebSocket connection
+	server.GET("/__serve_hmr/events", func(c echo.Context) error {
+		return s.clients.AddEventStream(c.Response(), c.Request(), s.buildErrors.sendCurrent)
+	})
+
+	addClientScriptRoutes(server)
+
+	server.POST("/__serve_hmr/events", func(c echo.Context) error {
+		id, err := strconv.ParseUint(c.QueryParam("client"), 10, 64)
+		if err != nil {
+			return c.String(400, "Invalid client id")
+		}
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		if !s.clients.HandleClientMessage(id, body) {
+			return c.String(404, "Client not connected")
+		}
+		return c.NoContent(204)
+	})
+}
+
+// AddFileRoutes serves the files from the root directory under the
+// base url, e.g. "/static", or an empty string for the server root.
+// It can be called multiple times to mount several directories.
+//
+// The files missing in the root directory are served from the first
+// of the fallback directories that has them, as if all of them were
+// merged into one.
+func (s *Server) AddFileRoutes(baseUrl string, rootDir string, conf *Configuration, fallbackDirs ...string) *FileRoutes {
+	layers := []utils.Layer{utils.DirLayer(rootDir)}
+	for _, dir := range fallbackDirs {
+		layers = append(layers, utils.DirLayer(dir))
+	}
+	return s.AddFsRoutes(baseUrl, conf, layers...)
+}
+
+// AddFsRoutes serves the files of the layers under the base url, the
+// files are taken from the first layer having them. The layers can be
+// any filesystems, e.g. an embed.FS or an archive, only the changes of
+// the directories on the disk are watched.
+func (s *Server) AddFsRoutes(baseUrl string, conf *Configuration, layers ...utils.Layer) *FileRoutes {
+	server := s.echo
+	routes := &FileRoutes{
+		BaseUrl: baseUrl,
+		owner:   s,
+		server:  server,
+		overlay: utils.CreateOverlay(layers...),
+		cache:   CreateCache(conf.MaxCacheSize, conf.MaxCacheFileSize),
+	}
+	if len(layers) > 0 && layers[0].Dir != "" {
+		routes.RootDir = layers[0].Dir + "/"
+	}
+	routes.config.Store(conf)
+	s.metrics.AddCache(routes.Mount(), routes.cache)
+
+	s.mutex.Lock()
+	s.mounts = append(s.mounts, routes)
+	s.mutex.Unlock()
+
+	routes.fillCache()
+
+	if conf.Watcher {
+		s.addHmrRoutes()
+
+		// served directories are under the empty namespace,
+		// additional ones under the path they were specified with
+		roots := map[string]string{}
+		watched := []watchedDir{}
+		for _, l := range routes.overlay.Layers {
+			if l.Dir == "" {
+				if l.Source != "" {
+					server.Logger.Warnf("The changes of the files in %s are not watched", l.Source)
+				}
+				continue
+			}
+			watched = append(watched, watchedDir{namespace: "", dir: l.Dir})
+		}
+		for _, extra := range conf.WatchExtra {
+			absDir, err := fp.Abs(extra)
+			if err != nil {
+				server.Logger.Errorf("Invalid watch directory(%s): %s", extra, err.Error())
+				continue
+			}
+			namespace := fp.ToSlash(fp.Clean(extra))
+			roots[namespace] = absDir
+			watched = append(watched, watchedDir{namespace: namespace, dir: absDir})
+		}
+
+		onFlush := func(events []utils.WatchEvent) {
+			routes.broadcastFileEvents(roots, events)
+		}
+		if conf.OnChange != "" {
+			routes.builder = CreateBuilder(
+				conf.OnChange,
+				server.Logger,
+				func(ok bool, output string, held []utils.WatchEvent) {
+					if !ok {
+						s.buildErrors.Report(BuildError{Message: output})
+						return
+					}
+					if len(held) > 0 {
+						routes.broadcastFileEvents(roots, held)
+					} else {
+						s.buildErrors.Clear()
+					}
+				},
+			)
+			onFlush = routes.builder.OnWatchEvents(onFlush)
+		}
+
+		batcher := utils.CreateEventBatcher(
+			time.Duration(conf.WatchDebounce)*time.Millisecond,
+			onFlush,
+		)
+		routes.batcher = batcher
+
+		filter := &utils.WatchFilter{
+			Include: conf.WatchInclude,
+			Ignore:  conf.WatchIgnore,
+		}
+
+		for _, wd := range watched {
+			w, err := utils.CreateFsWatcher(conf.WatchMode, wd.dir, time.Millisecond*250, filter)
+			if err != nil {
+				server.Logger.Errorf("Failed to start watcher for %s: %s", wd.dir, err.Error())
+				continue
+			}
+			routes.watchers = append(routes.watchers, w)
+
+			go func(namespace string) {
+				for {
+					select {
+					case ev, ok := <-w.Events():
+						if !ok {
+							return
+						}
+						ev.Root = namespace
+						s.metrics.CountWatcherEvent(ev.Op)
+						batcher.Push(ev)
+					case err := <-w.Errors():
+						server.Logger.Errorf("Watcher error: %s", err.Error())
+					}
+				}
+			}(wd.namespace)
+		}
+	}
+
+	server.GET(baseUrl+"/*", func(c echo.Context) error {
+		routePath := c.Param("*")
+		conf := routes.Config()
+
+		server.Logger.Debugf("Received request for file: %s", routePath)
+
+		err, foundInCache := routes.SendFromCache(c, conf, routePath)
+
+		if err != nil {
+			return err
+		}
+
+		if foundInCache {
+			return nil
+		}
+
+		// check if files exists in fs, and if it does load it into memory
+		// and serve it
+		if _, layer := routes.overlay.Find(routePath, 0); layer != -1 {
+			file, err := routes.loadFile(routePath, conf)
+
+			if err == nil {
+				routes.cache.Push(file)
+
+				c.Set(ctxCacheStatus, "miss")
+				return routes.sendFile(file, c, conf)
+			} else {
+				server.Logger.Errorf("Failed to read the file(%s): %s", routes.overlay.Location(layer, routePath), err.Error())
+			}
+		}
+
+		if conf.SpaFile != "" {
+			relpath := strings.TrimPrefix(conf.SpaFile, "./")
+
+			err, foundInCache := routes.SendFromCache(c, conf, relpath)
+
+			if err != nil {
+				return err
+			}
+
+			if foundInCache {
+				return nil
+			}
+
+			file, err := routes.loadFile(relpath, conf)
+			if err == nil {
+				routes.cache.Push(file)
+
+				c.Set(ctxCacheStatus, "miss")
+				return routes.sendFile(file, c, conf)
+			} else {
+				server.Logger.Errorf("Failed to read the file(%s): %s", relpath, err.Error())
+			}
+		} else if conf.RedirectTo != "" {
+			server.Logger.Debugf(
+				"Requested file not found, redirecting to: %s",
+				conf.RedirectTo,
+			)
+			return c.Redirect(302, conf.RedirectTo)
+		}
+
+		server.Logger.Debug("Requested file not found")
+		return c.String(404, "Not found")
+	})
+
+	return routes
+}
+
+func (r *FileRoutes) sendFile(file *StaticFile, c echo.Context, conf *Configuration) error {
+	sresp := &StaticResponse{
+		file:                     file,
+		cacheMaxAge:              86400,
+		cacheRequireRevalidation: false,
+		acceptRangeRequests:      !conf.NoStreaming,
+		isPrivate:                false,
+		contentType:              file.ContentType,
+	}
+
+	if conf.BeforeSend != nil {
+		err := conf.BeforeSend(sresp, c)
+		if err != nil {
+			return err
+		}
+		if sresp.shouldSendInstead {
+			return sresp.sendInstead
+		}
+	}
+
+	if conf.Watcher {
+		r.owner.dependencies.Record(c, file)
+	}
+
+	h := c.Response().Header()
+	h.Set("Last-Modified", file.LastModifiedAtRFC)
+	h.Set("Date", time.Now().Format(http.TimeFormat))
+	h.Set("Content-Type", sresp.contentType)
+	h.Set("Cache-Control", sresp.buildCacheControlHeader(conf))
+	for name, value := range conf.Headers {
+		h.Set(name, value)
+	}
+
+	if sresp.acceptRangeRequests {
+		h.Set("Accept-Ranges", "bytes")
+
+		requestedRange := utils.ParseRangeHeader(c)
+		if requestedRange != nil {
+			h.Set("Connection", "keep-alive")
+			h.Set("Keep-Alive", "timeout=5, max=1000")
+
+			if !requestedRange.HasEnd {
+				requestedRange.End = uint64(file.Length() - 1)
+			}
+
+			c.Logger().Debugf("Requested range for file %s: %d-%d", file.RelPath, requestedRange.Start, requestedRange.End)
+
+			contentLength := strconv.FormatUint(requestedRange.End-requestedRange.Start+1, 10)
+			contentRange := ("bytes " +
+				strconv.FormatUint(requestedRange.Start, 10) +
+				"-" + strconv.FormatUint(requestedRange.End, 10) +
+				"/" + strconv.FormatInt(int64(file.Length()), 10))
+			h.Set("Content-Length", contentLength)
+			h.Set("Content-Range", contentRange)
+			c.Set(ctxRange, strings.TrimPrefix(contentRange, "bytes "))
+
+			// write through the echo.Response so that the status
+			// and the number of sent bytes are tracked
+			writer := c.Response()
+			writer.WriteHeader(206)
+
+			retBuff := file.GetContent()[requestedRange.Start : requestedRange.End+1]
+			retBuffLen := uint64(len(retBuff))
+			chunkSize := conf.ChunkSize
+			if retBuffLen > chunkSize {
+
+				for i := uint64(0); i < retBuffLen; i += chunkSize {
+					end := i + chunkSize
+					if end > retBuffLen {
+						end = retBuffLen
+					}
+
+					// check if the request channel is still opened
+					// and stop sending if it's not
+					channelDone := c.Request().Context().Done()
+					select {
+					case <-channelDone:
+						return nil
+					default:
+						// no-op
+					}
+					writer.Write(retBuff[i:end])
+					writer.Flush()
+
+					c.Logger().Debugf(
+						"Sending chunk %d-%d/%d",
+						requestedRange.Start+i,
+						requestedRange.Start+end,
+						contentLength,
+					)
+				}
+			} else {
+				writer.Write(retBuff)
+				writer.Flush()
+
+				c.Logger().Debugf(
+					"Sending chunk %d-%d/%d",
+					requestedRange.Start,
+					requestedRange.End,
+					contentLength,
+				)
+			}
+
+			return nil
+		}
+	}
+
+	if conf.Watcher && conf.HotModules && isModuleFile(file.Path) {
+		return r.sendModule(file, c, conf)
+	}
+
+	if c.Request().Header.Get("If-None-Match") == file.Etag || c.Request().Header.Get("If-Modified-Since") == file.LastModifiedAtRFC {
+		c.Logger().Debug("Resource not modified, returning 304")
+		return c.NoContent(304)
+	}
+	if !conf.ExcludeEtag {
+		h.Set("ETag", file.Etag)
+	}
+
+	content := file.GetContent()
+
+	if conf.Watcher && strings.Contains(file.ContentType, "text/html") {
+		nonce := injectedScriptNonce(content, conf, h.Get("Content-Security-Policy"))
+		content = addHmrScript(content, conf, nonce)
+	}
+
+	return c.Blob(200, file.ContentType, content)
+}
+
+var cspNonceRegex = regexp.MustCompile(`'nonce-([^']+)'`)
+var scriptNonceRegex = regexp.MustCompile(`(?i)<script[^>]*\snonce=["']?([^"'\s>]+)`)
+
+// injectedScriptNonce returns the nonce to set on the injected scripts.
+// With the `auto` option the nonce is taken from the policy in the
+// Content-Security-Policy header, or from the scripts of the page.
+func injectedScriptNonce(html []byte, conf *Configuration, csp string) string {
+	if conf.CspNonce != CspNonceAuto {
+		return conf.CspNonce
+	}
+	if m := cspNonceRegex.FindStringSubmatch(csp); m != nil {
+		return m[1]
+	}
+	if m := scriptNonceRegex.FindSubmatch(html); m != nil {
+		return string(m[1])
+	}
+	return ""
+}
+
+func addHmrScript(html []byte, conf *Configuration, nonce string) []byte {
+	comment := "<!-- Code injected by 'goserve' -->"
+	commentEnd := "<!-- End of injected code -->"
+
+	nonceAttr := ""
+	if nonce != "" {
+		nonceAttr = fmt.Sprintf(" nonce=\"%s\"", nonce)
+	}
+
+	scripts := []string{HmrScriptPath}
+	if conf.AutoReload {
+		scripts = append(scripts, AutoReloadScriptPath)
+	}
+	if conf.HotCss {
+		scripts = append(scripts, CssReloadScriptPath)
+	}
+
+	tag := []byte(fmt.Sprintf("  %s\n", comment))
+	for _, src := range scripts {
+		tag = append(tag, fmt.Sprintf("    <script src=\"%s\"%s></script>\n", src, nonceAttr)...)
+	}
+	tag = append(tag, fmt.Sprintf("    %s\n  ", commentEnd)...)
+
+	idx := utils.FindHeadInjectionPoint(html)
+
+	// when injected after the opening <body> tag, the meta tags added
+	// earlier are at the same point, the scripts need to come after them
+	rest := html[idx:]
+	if bytes.HasPrefix(bytes.TrimLeft(rest, " \t\r\n"), []byte(`<meta name="_serve:fname"`)) {
+		lastMeta := bytes.Index(rest, []byte(`<meta name="_serve:fsize"`))
+		if lastMeta != -1 {
+			if end := bytes.Index(rest[lastMeta:], []byte("/>\n")); end != -1 {
+				idx += lastMeta + end + 3
+			}
+		}
+	}
+
+	return utils.InjectAt(html, idx, tag)
+}
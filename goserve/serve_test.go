@@ -0,0 +1,128 @@
+package goserve
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"os"
+	fp "path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestInjectedScriptNonce(t *testing.T) {
+	tests := []struct {
+		name   string
+		option string
+		csp    string
+		html   string
+		want   string
+	}{
+		{name: "disabled", html: `<script nonce="abc"></script>`, want: ""},
+		{name: "fixed", option: "fixed123", csp: "script-src 'nonce-abc'", want: "fixed123"},
+		{name: "from the header", option: CspNonceAuto, csp: "default-src 'self'; script-src 'nonce-r4nd0m+/='", want: "r4nd0m+/="},
+		{name: "header before page", option: CspNonceAuto, csp: "script-src 'nonce-header'", html: `<script nonce="page"></script>`, want: "header"},
+		{name: "from the page", option: CspNonceAuto, html: `<SCRIPT type="module" nonce='page1'></SCRIPT>`, want: "page1"},
+		{name: "unquoted", option: CspNonceAuto, html: `<script nonce=page2 src=a.js></script>`, want: "page2"},
+		{name: "none", option: CspNonceAuto, html: `<script src="a.js"></script>`, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := &Configuration{CspNonce: tt.option}
+			if got := injectedScriptNonce([]byte(tt.html), conf, tt.csp); got != tt.want {
+				t.Errorf("injectedScriptNonce() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddHmrScript(t *testing.T) {
+	conf := &Configuration{AutoReload: true}
+	html := "<html><head><title>a</title></head><body></body></html>"
+
+	got := string(addHmrScript([]byte(html), conf, "abc"))
+	for _, src := range []string{HmrScriptPath, AutoReloadScriptPath} {
+		tag := `<script src="` + src + `" nonce="abc"></script>`
+		if !strings.Contains(got, tag) {
+			t.Errorf("addHmrScript() = %q, missing %q", got, tag)
+		}
+	}
+	if strings.Contains(got, CssReloadScriptPath) {
+		t.Errorf("addHmrScript() = %q, unexpected %q", got, CssReloadScriptPath)
+	}
+	if !strings.HasSuffix(got, "</head><body></body></html>") || strings.Index(got, "<script") < strings.Index(got, "</title>") {
+		t.Errorf("addHmrScript() = %q, not injected before </head>", got)
+	}
+
+	got = string(addHmrScript([]byte(html), conf, ""))
+	if strings.Contains(got, "nonce") {
+		t.Errorf("addHmrScript() = %q, unexpected nonce", got)
+	}
+}
+
+func TestRevalidateConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	path := fp.Join(dir, "app.js")
+	os.WriteFile(path, []byte("version 0"), 0644)
+
+	s := AttachServer(echo.New())
+	defer s.Close()
+	s.AddFileRoutes("", dir, DefaultConfiguration())
+	s.AddAdminRoutes(s.Echo().Group("/admin"), "")
+
+	get := func(url string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		return rec
+	}
+
+	// the file changes while the requests and the admin
+	// listing read the cached entry
+	stop := make(chan struct{})
+	written := make(chan int)
+	tmp := fp.Join(t.TempDir(), "app.js")
+	go func() {
+		modTime := time.Now()
+		i := 0
+		for {
+			select {
+			case <-stop:
+				written <- i
+				return
+			default:
+			}
+			i++
+			os.WriteFile(tmp, []byte(fmt.Sprintf("version %d", i)), 0644)
+			modTime = modTime.Add(time.Second)
+			os.Chtimes(tmp, modTime, modTime)
+			os.Rename(tmp, path)
+		}
+	}()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if rec := get("/app.js"); rec.Code != 200 || !strings.HasPrefix(rec.Body.String(), "version ") {
+					t.Errorf("GET /app.js = %d %q", rec.Code, rec.Body.String())
+				}
+				if rec := get("/admin/cache"); rec.Code != 200 {
+					t.Errorf("GET /admin/cache = %d", rec.Code)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	last := <-written
+
+	if rec := get("/app.js"); rec.Body.String() != fmt.Sprintf("version %d", last) {
+		t.Errorf("GET /app.js = %q, want the last version", rec.Body.String())
+	}
+}
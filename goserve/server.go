@@ -0,0 +1,170 @@
+package goserve
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/ncpa0cpl/static-server/utils"
+)
+
+// Server holds the state shared by the file routes it adds to an echo
+// instance: the HMR clients, the reported build errors, the pages
+// dependencies, the module graph and the metrics. Any number of
+// servers can coexist in one process, each on its own echo instance.
+type Server struct {
+	echo     *echo.Echo
+	mutex    *sync.Mutex
+	mounts   []*FileRoutes
+	upgrader websocket.Upgrader
+
+	clients      *utils.WsController
+	buildErrors  *ErrorReporter
+	dependencies *DependencyTracker
+	hotModules   *ModuleGraph
+	metrics      *Metrics
+
+	hmrRoutes   sync.Once
+	lastBatchId atomic.Uint64
+}
+
+// DefaultConfiguration returns the configuration the command line
+// tool starts with, one that passes the validation.
+func DefaultConfiguration() *Configuration {
+	return &Configuration{
+		MaxCacheSize:     100,
+		MaxCacheFileSize: 10,
+		ChunkSize:        2048 * 1024,
+		WatchDebounce:    100,
+		WatchMode:        utils.WatchModeNative,
+	}
+}
+
+// AttachServer creates a server adding its routes to the existing
+// echo instance.
+func AttachServer(e *echo.Echo) *Server {
+	clients := utils.CreateWsController()
+	return &Server{
+		echo:         e,
+		mutex:        &sync.Mutex{},
+		clients:      clients,
+		buildErrors:  CreateErrorReporter(clients),
+		dependencies: CreateDependencyTracker(),
+		hotModules:   CreateModuleGraph(),
+		metrics:      CreateMetrics(clients),
+	}
+}
+
+// CreateServer creates a server on a new echo instance serving the
+// mounts of the configuration, it can be used as an http.Handler.
+func CreateServer(conf *Configuration) (*Server, error) {
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+
+	s := AttachServer(e)
+	err := s.AddMounts(conf)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// ServeHTTP serves the requests with the echo instance of the server,
+// including any other routes added to it.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.echo.ServeHTTP(w, r)
+}
+
+// Echo returns the echo instance the routes are added to.
+func (s *Server) Echo() *echo.Echo {
+	return s.echo
+}
+
+// Mounts returns the file routes added to the server,
+// in the order they were added.
+func (s *Server) Mounts() []*FileRoutes {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]*FileRoutes{}, s.mounts...)
+}
+
+// HMR returns the controller of the connected HMR clients, which
+// can be used to send custom messages, or to subscribe to the
+// messages sent to the clients.
+func (s *Server) HMR() *utils.WsController {
+	return s.clients
+}
+
+// BuildErrors returns the reporter of the build errors
+// displayed by the clients.
+func (s *Server) BuildErrors() *ErrorReporter {
+	return s.buildErrors
+}
+
+// Metrics returns the request and cache statistics, collected
+// once its middleware is added to the echo instance.
+func (s *Server) Metrics() *Metrics {
+	return s.metrics
+}
+
+// AddMounts serves the directories and archives of the mounts of the
+// configuration, each with the options of the mount applied. The first
+// one is the primary mount, see Configuration.ForMount.
+func (s *Server) AddMounts(conf *Configuration) error {
+	err := conf.Validate()
+	if err != nil {
+		return err
+	}
+
+	for i, mount := range conf.Mounts {
+		mountConf, err := conf.ForMount(mount, i == 0)
+		if err != nil {
+			return err
+		}
+		layers, err := mountLayers(mount)
+		if err != nil {
+			return err
+		}
+
+		prefix := NormalizeMountPrefix(mount.Prefix)
+		s.echo.Logger.Info(fmt.Sprintf("Serving files from: %s at %s/", mount.Dir, prefix))
+		if len(mount.Fallback) > 0 {
+			s.echo.Logger.Info(fmt.Sprintf("Falling back to: %s", strings.Join(mount.Fallback, ", ")))
+		}
+		s.AddFsRoutes(prefix, mountConf, layers...)
+	}
+	return nil
+}
+
+// mountLayers opens the directories and archives of the mount.
+func mountLayers(mount Mount) ([]utils.Layer, error) {
+	layers := []utils.Layer{}
+	for _, dir := range append([]string{mount.Dir}, mount.Fallback...) {
+		layer, err := utils.OpenLayer(dir)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+	return layers, nil
+}
+
+// Close stops the file watchers and the running builds of all
+// the mounts, and disconnects the HMR clients.
+func (s *Server) Close() {
+	for _, routes := range s.Mounts() {
+		routes.Close()
+	}
+	s.clients.CloseAll()
+}
+
+func (s *Server) nextBatchId() string {
+	return strconv.FormatUint(s.lastBatchId.Add(1), 10)
+}
@@ -2,43 +2,307 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"os/signal"
 	path "path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	echo "github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/labstack/gommon/log"
 
+	"github.com/ncpa0cpl/static-server/goserve"
 	"github.com/ncpa0cpl/static-server/utils"
 )
 
 func main() {
-	args := utils.ParseArgs(os.Args[1:], []string{
+	os.Exit(run(os.Args[1:]))
+}
+
+// buildConfiguration creates the file routes configuration from the
+// config file, if one was specified, and the command line options.
+// Options given on the command line take precedence over the file.
+func buildConfiguration(args *utils.ParsedArgs) (*goserve.Configuration, error) {
+	conf := goserve.DefaultConfiguration()
+
+	if configFile := args.GetParam("config", ""); configFile != "" {
+		var err error
+		conf, err = goserve.LoadConfigFile(configFile, conf)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if args.HasParam("redirect") {
+		conf.RedirectTo = args.GetParam("redirect", "")
+	}
+	if args.HasParam("spa") {
+		conf.SpaFile = args.GetParam("spa", "")
+	}
+	if args.HasParam("noetag") {
+		conf.ExcludeEtag = true
+	}
+	if args.HasParam("maxage") {
+		conf.MaxAge = args.GetParamInt("maxage", conf.MaxAge)
+	}
+	if args.HasParam("nocache") {
+		conf.NoCache = true
+	}
+	if args.HasParam("cache:max") {
+		conf.MaxCacheSize = args.GetParamUint64("cache:max", conf.MaxCacheSize)
+	}
+	if args.HasParam("cache:flimit") {
+		conf.MaxCacheFileSize = args.GetParamUint64("cache:flimit", conf.MaxCacheFileSize)
+	}
+	if args.HasParam("watch") || args.HasParam("aw") {
+		conf.Watcher = true
+	}
+	if args.HasParam("auto-reload") || args.HasParam("aw") {
+		conf.AutoReload = true
+	}
+	if args.HasParam("watch-mode") {
+		conf.WatchMode = args.GetParam("watch-mode", conf.WatchMode)
+	}
+	if args.HasParam("watch-include") {
+		conf.WatchInclude = args.GetParamList("watch-include")
+	}
+	if args.HasParam("watch-ignore") {
+		conf.WatchIgnore = args.GetParamList("watch-ignore")
+	}
+	if args.HasParam("watch-extra") {
+		conf.WatchExtra = args.GetParamList("watch-extra")
+	}
+	if args.HasParam("on-change") {
+		conf.OnChange = args.GetParam("on-change", "")
+	}
+	if args.HasParam("watch-debounce") {
+		conf.WatchDebounce = args.GetParamInt("watch-debounce", conf.WatchDebounce)
+	}
+	if args.HasParam("csp-nonce") {
+		conf.CspNonce = args.GetParam("csp-nonce", "")
+	}
+	if args.HasParam("hot-css") {
+		conf.HotCss = true
+	}
+	if args.HasParam("hot-modules") {
+		conf.HotModules = true
+	}
+	if args.HasParam("chunk-size") {
+		conf.ChunkSize = args.GetParamUint64("chunk-size", 2048) * 1024
+	}
+	if args.HasParam("no-streaming") {
+		conf.NoStreaming = true
+	}
+
+	return conf, conf.Validate()
+}
+
+// resolveMounts returns the directories to serve with their absolute
+// paths. The directory given as the input is served at the root, and
+// the mounts from the config file and the `--mount` options under their
+// prefixes. The current directory is served at the root if there are
+// no mounts at all. The first mount is the primary one. The `--fallback`
+// directories are added to the mount at the root.
+func resolveMounts(args *utils.ParsedArgs, conf *goserve.Configuration) ([]goserve.Mount, error) {
+	mounts := slices.Clone(conf.Mounts)
+
+	addMount := func(mount goserve.Mount, first bool) {
+		for i := range mounts {
+			if goserve.NormalizeMountPrefix(mounts[i].Prefix) == goserve.NormalizeMountPrefix(mount.Prefix) {
+				// the options from the config file are kept
+				mounts[i].Dir = mount.Dir
+				if mount.Fallback != nil {
+					mounts[i].Fallback = mount.Fallback
+				}
+				return
+			}
+		}
+		if first {
+			mounts = slices.Insert(mounts, 0, mount)
+		} else {
+			mounts = append(mounts, mount)
+		}
+	}
+
+	for _, value := range args.GetParamList("mount") {
+		mount, err := goserve.ParseMount(value)
+		if err != nil {
+			return nil, err
+		}
+		addMount(mount, false)
+	}
+	if args.Input != "" || len(mounts) == 0 {
+		dir := args.Input
+		if dir == "" {
+			dir = "."
+		}
+		addMount(goserve.Mount{Prefix: "", Dir: dir}, true)
+	}
+	if fallback := args.GetParamList("fallback"); len(fallback) > 0 {
+		idx := slices.IndexFunc(mounts, func(m goserve.Mount) bool {
+			return goserve.NormalizeMountPrefix(m.Prefix) == ""
+		})
+		if idx == -1 {
+			return nil, fmt.Errorf("--fallback requires a directory served at the root")
+		}
+		mounts[idx].Fallback = append(slices.Clone(mounts[idx].Fallback), fallback...)
+	}
+
+	prefixes := map[string]bool{}
+	for i := range mounts {
+		mount := &mounts[i]
+		mount.Prefix = goserve.NormalizeMountPrefix(mount.Prefix)
+		if prefixes[mount.Prefix] {
+			return nil, fmt.Errorf("duplicate mount prefix: %q", mount.Prefix+"/")
+		}
+		prefixes[mount.Prefix] = true
+
+		dir, err := absServedPath(mount.Dir)
+		if err != nil {
+			return nil, err
+		}
+		mount.Dir = dir
+
+		fallback := make([]string, len(mount.Fallback))
+		for j, dir := range mount.Fallback {
+			fallback[j], err = absServedPath(dir)
+			if err != nil {
+				return nil, err
+			}
+		}
+		mount.Fallback = fallback
+	}
+
+	return mounts, nil
+}
+
+// absServedPath returns the absolute path of the directory, or
+// the archive, to serve the files from.
+func absServedPath(dir string) (string, error) {
+	abs, err := path.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("unable to determine the serve directory: %s", err.Error())
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", fmt.Errorf("serve directory does not exist: %s", dir)
+	}
+	if !info.IsDir() && !utils.IsArchive(abs) {
+		return "", fmt.Errorf("not a directory or a supported archive: %s", dir)
+	}
+	return abs, nil
+}
+
+// adminAddress returns the address the admin API listens on, given
+// either a port, which is bound to the loopback interface, or a host
+// and a port.
+func adminAddress(adminPort string) string {
+	if strings.Contains(adminPort, ":") {
+		return adminPort
+	}
+	return "127.0.0.1:" + adminPort
+}
+
+// updateMountsConfig applies the reloaded configuration to the running
+// mounts, matched by their prefix. Mounts cannot be added or removed
+// without a restart.
+func updateMountsConfig(s *goserve.Server, args *utils.ParsedArgs, conf *goserve.Configuration) error {
+	mounts, err := resolveMounts(args, conf)
+	if err != nil {
+		return err
+	}
+	logger := s.Echo().Logger
+	routes := s.Mounts()
+	configs := make([]*goserve.Configuration, len(routes))
+	matched := 0
+	for i, r := range routes {
+		configs[i] = r.Config()
+		for _, mount := range mounts {
+			if mount.Prefix != r.BaseUrl {
+				continue
+			}
+			matched++
+			if !slices.Equal(append([]string{mount.Dir}, mount.Fallback...), r.Sources()) {
+				logger.Warnf("The directories of the mount %s/ cannot be changed without a restart", r.BaseUrl)
+			}
+			configs[i], err = conf.ForMount(mount, i == 0)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if matched != len(routes) || matched != len(mounts) {
+		logger.Warn("Mounts cannot be added or removed without a restart")
+	}
+
+	// applied once all of them are known to be valid
+	for i, r := range routes {
+		err := r.UpdateConfig(configs[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func run(argv []string) int {
+	if len(argv) > 0 && argv[0] == "events" {
+		return runEvents(argv[1:])
+	}
+
+	args := utils.ParseArgs(argv, []string{
 		"--help",
 		"--aw",
 		"--watch",
 		"--auto-reload",
+		"--hot-css",
+		"--hot-modules",
+		"--errors-stdin",
 		"--nocache",
 		"--noetag",
+		"--metrics",
+		"--admin",
 	})
 
 	if args.NamedParams.Has("help") {
-		fmt.Println("Usage: goserve [options] [directory]")
+		fmt.Println("Usage: goserve [options] [directory|archive]")
+		fmt.Println("       goserve events [options] [address]")
 		fmt.Println("")
 		fmt.Println("Options:")
 		fmt.Println("  --help              Print this help message.")
+		fmt.Println("  --config <file>     Load options from a JSON file. The file is reloaded on change or on SIGHUP.")
 		fmt.Println("  --loglevel <level>  The log level. Default: info")
 		fmt.Println("  --port <port>       The port to serve on. Default: 8080")
 		fmt.Println("  --redirect <url>    Redirect all unmatched routes to a specified url.")
 		fmt.Println("  --spa <filepath>    Specify a file to send for all unmatched routes.")
+		fmt.Println("  --mount <url>=<dir> Serve a directory under a url prefix, e.g. /static=./dist. Can be repeated.")
+		fmt.Println("  --fallback <dir>    Serve the files missing in the served directory from another directory or archive. Can be repeated, the first one having the file wins.")
 		fmt.Println("  --chunk-size <KB>   The size of chunks when streaming. Default: 2048KB")
 		fmt.Println("  --no-streaming      Disables the server ability to process Range requests and sending partial content.")
 		fmt.Println("  --compress          Compress responses using the GZip algorithm.")
+		fmt.Println("  --metrics           Expose server and cache statistics in the Prometheus format at '/__serve/metrics'.")
 		fmt.Println("")
 		fmt.Println("Hot Module Reload")
 		fmt.Println("  --aw           Alias for '--watch --auto-reload'")
 		fmt.Println("  --watch        When enabled, server will send fs events when files are changed. To listen to these add event listeners to `window.HMR` on client side.")
 		fmt.Println("  --auto-reload  Automatically inject a script to html files that will reload the page on a 'watch' change event.")
+		fmt.Println("  --hot-css      Swap stylesheets linked by the page when they change, without reloading the page.")
+		fmt.Println("  --hot-modules  Re-execute the changed ES modules that accept the update via 'import.meta.hot', without reloading the page.")
+		fmt.Println("  --watch-debounce <ms>  Time to wait for more fs events before sending them as one batch. Default: 100")
+		fmt.Println("  --watch-mode <mode>    How to detect file changes: native (inotify on Linux) or poll. Default: native")
+		fmt.Println("  --watch-include <glob> Only report changes of files matching the pattern. Can be repeated.")
+		fmt.Println("  --watch-ignore <glob>  Do not watch files and directories matching the pattern. Can be repeated.")
+		fmt.Println("  --watch-extra <dir>    Watch an additional directory, its events are sent with the 'root' field set to the directory. Can be repeated.")
+		fmt.Println("  --on-change <cmd>      Run the command when files in the '--watch-extra' directories change. Change events are sent once the build finishes.")
+		fmt.Println("  --errors-stdin         Read build errors as JSON lines from stdin and display them in an overlay in the browser.")
+		fmt.Println("  --csp-nonce <nonce>    Nonce to set on the injected scripts, 'auto' takes it from the Content-Security-Policy header or the page's scripts.")
 		fmt.Println("")
 		fmt.Println("Cache Headers Options")
 		fmt.Println("  --maxage <seconds>   The max-age value to set in the Cache-Control header.")
@@ -48,33 +312,26 @@ func main() {
 		fmt.Println("Server Cache")
 		fmt.Println("  --cache:max <MB>     Maximum size of all files in the cache. Default: 100MB")
 		fmt.Println("  --cache:flimit <MB>  Maximum size of single file that can be put in cache. Default: 10MB")
-		return
+		fmt.Println("")
+		fmt.Println("Shutdown")
+		fmt.Println("  --shutdown-timeout <seconds>  Time given to in-flight requests to finish on SIGINT/SIGTERM. Default: 10")
+		fmt.Println("")
+		fmt.Println("Admin API")
+		fmt.Println("  --admin                 Enable the admin API under the '/__serve/admin' prefix.")
+		fmt.Println("  --admin-port <port>     Serve the admin API on a separate port instead, on 127.0.0.1 unless given as <host>:<port>.")
+		fmt.Println("  --admin-token <token>   Token required in the Authorization header. Generated if not specified and the API is not on a separate port.")
+		fmt.Println("")
+		fmt.Println("Access Log")
+		fmt.Println("  --access-log <format>        Log every request in the given format: common, combined or json.")
+		fmt.Println("  --access-log-file <path>     Write the access log to a file instead of the stdout.")
+		fmt.Println("  --access-log:max <MB>        Size after which the access log file is rotated. Default: 10MB")
+		fmt.Println("  --access-log:backups <n>     Number of rotated access log files to keep. Default: 3")
+		return ExitOk
 	}
 
 	if args.HasParam("spa") && args.HasParam("redirect") {
 		fmt.Println("Cannot specify both --spa and --redirect.")
-		return
-	}
-
-	var rootDir string
-	if args.Input != "" {
-		if path.IsAbs(args.Input) {
-			rootDir = args.Input
-		} else {
-			wd, err := os.Getwd()
-			if err != nil {
-				fmt.Println("Unable to determine the serve directory.")
-				return
-			}
-			rootDir = path.Join(wd, args.Input)
-		}
-	} else {
-		wd, err := os.Getwd()
-		if err != nil {
-			fmt.Println("Unable to determine the serve directory.")
-			return
-		}
-		rootDir = wd
+		return ExitError
 	}
 
 	server := echo.New()
@@ -92,27 +349,156 @@ func main() {
 		server.Logger.SetLevel(log.OFF)
 	}
 
+	s := goserve.AttachServer(server)
+
+	if args.HasParam("access-log") {
+		var out io.Writer = os.Stdout
+		if logFile := args.GetParam("access-log-file", ""); logFile != "" {
+			rf, err := utils.OpenRotatingFile(
+				logFile,
+				args.GetParamUint64("access-log:max", 10)*1024*1024,
+				args.GetParamInt("access-log:backups", 3),
+			)
+			if err != nil {
+				fmt.Printf("Unable to open the access log file: %s\n", err.Error())
+				return ExitError
+			}
+			defer rf.Close()
+			out = rf
+		}
+
+		format := args.GetParam("access-log", "")
+		if format == "" {
+			format = goserve.AccessLogCommon
+		}
+
+		accessLogger, err := goserve.CreateAccessLogger(format, out)
+		if err != nil {
+			fmt.Println(err.Error())
+			return ExitError
+		}
+		server.Use(accessLogger.Middleware())
+	}
+
+	if args.NamedParams.Has("metrics") {
+		server.Use(s.Metrics().Middleware())
+		server.GET("/__serve/metrics", s.Metrics().Handler())
+	}
+
 	if args.NamedParams.Has("compress") {
 		server.Use(middleware.Gzip())
 	}
 
-	server.Logger.Info(fmt.Sprintf("Serving files from: %s", rootDir))
-
-	AddFileRoutes(server, "", rootDir, &Configuration{
-		RedirectTo:       args.GetParam("redirect", ""),
-		SpaFile:          args.GetParam("spa", ""),
-		ExcludeEtag:      args.NamedParams.Has("noetag"),
-		MaxAge:           args.GetParamInt("maxage", 0),
-		NoCache:          args.NamedParams.Has("nocache"),
-		MaxCacheSize:     args.GetParamUint64("cache:max", 100),
-		MaxCacheFileSize: args.GetParamUint64("cache:flimit", 10),
-		Watcher:          args.NamedParams.Has("watch") || args.NamedParams.Has("aw"),
-		AutoReload:       args.NamedParams.Has("auto-reload") || args.NamedParams.Has("aw"),
-		ChunkSize:        args.GetParamUint64("chunk-size", 2048)*1024,
-		NoStreaming:      args.NamedParams.Has("no-streaming"),
-	})
+	conf, err := buildConfiguration(&args)
+	if err != nil {
+		fmt.Println(err.Error())
+		return ExitError
+	}
+
+	mounts, err := resolveMounts(&args, conf)
+	if err != nil {
+		fmt.Println(err.Error())
+		return ExitError
+	}
+
+	conf.Mounts = mounts
+	err = s.AddMounts(conf)
+	if err != nil {
+		fmt.Println(err.Error())
+		return ExitError
+	}
+
+	reloadMutex := &sync.Mutex{}
+	reload := func() {
+		reloadMutex.Lock()
+		defer reloadMutex.Unlock()
+
+		conf, err := buildConfiguration(&args)
+		if err == nil {
+			err = updateMountsConfig(s, &args, conf)
+		}
+		if err != nil {
+			server.Logger.Errorf("Failed to reload the configuration: %s", err.Error())
+			return
+		}
+		server.Logger.Info("Configuration reloaded")
+	}
+
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func() {
+		for range hangups {
+			reload()
+		}
+	}()
+
+	if configFile := args.GetParam("config", ""); configFile != "" {
+		stopWatching := goserve.WatchConfigFile(configFile, time.Second, reload)
+		defer stopWatching()
+	}
 
+	if !conf.Watcher && (conf.OnChange != "" || len(conf.WatchExtra) > 0) {
+		server.Logger.Warn("The --on-change and --watch-extra options have no effect without --watch")
+	}
+
+	if args.NamedParams.Has("errors-stdin") {
+		if conf.Watcher {
+			go s.BuildErrors().ReadErrors(os.Stdin, server.Logger)
+		} else {
+			server.Logger.Warn("The --errors-stdin option has no effect without --watch")
+		}
+	}
+
+	if args.NamedParams.Has("admin") || args.HasParam("admin-port") {
+		token := args.GetParam("admin-token", "")
+
+		if adminPort := args.GetParam("admin-port", ""); adminPort != "" {
+			admin := echo.New()
+			admin.HideBanner = true
+			admin.Logger = server.Logger
+			s.AddAdminRoutes(admin.Group(""), token)
+
+			go func() {
+				err := admin.Start(adminAddress(adminPort))
+				if err != nil && err != http.ErrServerClosed {
+					server.Logger.Errorf("Admin server error: %s", err.Error())
+				}
+			}()
+			defer admin.Close()
+		} else {
+			if token == "" {
+				token = goserve.GenerateAdminToken()
+				server.Logger.Infof("Admin API token: %s", token)
+			}
+			s.AddAdminRoutes(server.Group("/__serve/admin"), token)
+		}
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	serverErr := make(chan error, 1)
 	port := args.GetParam("port", "8080")
-	err := server.Start(fmt.Sprintf(":%s", port))
-	server.Logger.Fatal(err)
+	go func() {
+		serverErr <- server.Start(fmt.Sprintf(":%s", port))
+	}()
+
+	select {
+	case err := <-serverErr:
+		server.Logger.Error(err)
+		s.Close()
+		return ExitError
+	case sig := <-signals:
+		server.Logger.Infof("Received %s, shutting down", sig)
+	}
+
+	go func() {
+		// a second signal skips waiting for the requests to finish
+		<-signals
+		server.Logger.Warn("Forced shutdown")
+		os.Exit(ExitInterrupted)
+	}()
+
+	timeout := time.Duration(args.GetParamInt("shutdown-timeout", 10)) * time.Second
+	return Shutdown(server, s, timeout)
 }
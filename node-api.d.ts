@@ -11,16 +11,35 @@ import {
 import { Readable, Writable } from "stream";
 
 export declare interface ServeOptions {
+  config?: string;
   port?: number;
   loglevel?: "info" | "debug" | "warn" | "error";
   redirect?: string;
   spa?: string;
+  /** Directories to serve the files missing in the served directory from, in order. */
+  fallback?: string[];
+  /**
+   * Directories to serve under url prefixes, e.g. `{ "/static": "./dist" }`.
+   * An array of directories is merged, the first one having a file wins.
+   */
+  mounts?: Record<string, string | string[]>;
   chunkSize?: number;
   noStreaming?: boolean;
   compress?: boolean;
+  metrics?: boolean;
   hmr?: {
     watch?: boolean;
     autoReload?: boolean;
+    hotCss?: boolean;
+    hotModules?: boolean;
+    debounce?: number;
+    mode?: "native" | "poll";
+    include?: string[];
+    ignore?: string[];
+    extraDirs?: string[];
+    onChange?: string;
+    errorsFromStdin?: boolean;
+    cspNonce?: string;
   };
   cacheHeaders?: {
     maxAge?: number;
@@ -31,6 +50,19 @@ export declare interface ServeOptions {
     max?: number;
     fLimit?: number;
   };
+  shutdownTimeout?: number;
+  admin?: {
+    /** Port, or `<host>:<port>`, of the admin API. A port alone listens on 127.0.0.1. */
+    port?: number | string;
+    token?: string;
+  };
+  accessLog?: {
+    /** Defaults to "common". */
+    format?: "common" | "combined" | "json";
+    file?: string;
+    maxSize?: number;
+    backups?: number;
+  };
 }
 
 export declare type ServeSpawnOptions =
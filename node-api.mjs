@@ -13,6 +13,9 @@ export function serve(dirPath, options, spawnOptions) {
   /* @type {string[]} */
   const args = [];
 
+  if (options.config) {
+    args.push("--config", options.config);
+  }
   if (options.port) {
     args.push("--port", String(options.port));
   }
@@ -25,6 +28,12 @@ export function serve(dirPath, options, spawnOptions) {
   if (options.spa) {
     args.push("--spa", options.spa);
   }
+  for (const dir of options.fallback ?? []) {
+    args.push("--fallback", dir);
+  }
+  for (const [prefix, dirs] of Object.entries(options.mounts ?? {})) {
+    args.push("--mount", `${prefix}=${[].concat(dirs).join(path.delimiter)}`);
+  }
   if (options.chunkSize) {
     args.push("--chunk-size", String(options.chunkSize));
   }
@@ -34,6 +43,9 @@ export function serve(dirPath, options, spawnOptions) {
   if (options.compress) {
     args.push("--compress");
   }
+  if (options.metrics) {
+    args.push("--metrics");
+  }
   if (options.hmr) {
     if (options.hmr.watch) {
       args.push("--watch");
@@ -41,6 +53,36 @@ export function serve(dirPath, options, spawnOptions) {
     if (options.hmr.autoReload) {
       args.push("--auto-reload");
     }
+    if (options.hmr.hotCss) {
+      args.push("--hot-css");
+    }
+    if (options.hmr.hotModules) {
+      args.push("--hot-modules");
+    }
+    if (options.hmr.mode) {
+      args.push("--watch-mode", options.hmr.mode);
+    }
+    for (const pattern of options.hmr.include ?? []) {
+      args.push("--watch-include", pattern);
+    }
+    for (const pattern of options.hmr.ignore ?? []) {
+      args.push("--watch-ignore", pattern);
+    }
+    for (const dir of options.hmr.extraDirs ?? []) {
+      args.push("--watch-extra", dir);
+    }
+    if (options.hmr.onChange) {
+      args.push("--on-change", options.hmr.onChange);
+    }
+    if (options.hmr.errorsFromStdin) {
+      args.push("--errors-stdin");
+    }
+    if (options.hmr.cspNonce) {
+      args.push("--csp-nonce", options.hmr.cspNonce);
+    }
+    if (options.hmr.debounce !== undefined) {
+      args.push("--watch-debounce", String(options.hmr.debounce));
+    }
   }
   if (options.cacheHeaders) {
     if (options.cacheHeaders.maxAge) {
@@ -62,6 +104,32 @@ export function serve(dirPath, options, spawnOptions) {
     }
   }
 
+  if (options.shutdownTimeout) {
+    args.push("--shutdown-timeout", String(options.shutdownTimeout));
+  }
+  if (options.admin) {
+    if (options.admin.port) {
+      args.push("--admin-port", String(options.admin.port));
+    } else {
+      args.push("--admin");
+    }
+    if (options.admin.token) {
+      args.push("--admin-token", options.admin.token);
+    }
+  }
+  if (options.accessLog) {
+    args.push("--access-log", options.accessLog.format ?? "common");
+    if (options.accessLog.file) {
+      args.push("--access-log-file", options.accessLog.file);
+    }
+    if (options.accessLog.maxSize) {
+      args.push("--access-log:max", String(options.accessLog.maxSize));
+    }
+    if (options.accessLog.backups) {
+      args.push("--access-log:backups", String(options.accessLog.backups));
+    }
+  }
+
   args.push(dirPath);
 
   return spawn(path.resolve(__dirname, "serve"), args, spawnOptions);
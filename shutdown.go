@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncpa0cpl/static-server/goserve"
+)
+
+// Process exit codes
+const (
+	ExitOk              = 0
+	ExitError           = 1
+	ExitShutdownTimeout = 2
+	ExitInterrupted     = 130
+)
+
+// Shutdown stops accepting new connections, then stops the file watcher,
+// closes the HMR connections and waits for the in-flight requests to
+// finish, for at most the given timeout. Returns the exit code the
+// process should end with.
+func Shutdown(server *echo.Echo, s *goserve.Server, timeout time.Duration) int {
+	// called once the listeners are closed, so the clients
+	// cannot reconnect in the meantime
+	closed := make(chan struct{})
+	server.Server.RegisterOnShutdown(func() {
+		s.Close()
+		close(closed)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := server.Shutdown(ctx)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			server.Logger.Warnf("Requests did not finish within %s, closing connections", timeout)
+			server.Close()
+			return ExitShutdownTimeout
+		}
+		server.Logger.Errorf("Failed to shut down the server: %s", err.Error())
+		return ExitError
+	}
+
+	<-closed
+	server.Logger.Info("Server stopped")
+	return ExitOk
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// IsArchive reports whether the file is one of the archive
+// formats the files can be served from.
+func IsArchive(filepath string) bool {
+	name := strings.ToLower(filepath)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenArchive reads the whole archive into memory and returns
+// its files as a filesystem. The modification times of the files
+// are the ones stored in the archive.
+func OpenArchive(filepath string) (fs.FS, error) {
+	content, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.ToLower(filepath)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid zip archive(%s): %s", filepath, err.Error())
+		}
+		return reader, nil
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		gz, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip archive(%s): %s", filepath, err.Error())
+		}
+		defer gz.Close()
+		return readTar(filepath, gz)
+	case strings.HasSuffix(name, ".tar"):
+		return readTar(filepath, bytes.NewReader(content))
+	}
+	return nil, fmt.Errorf("unsupported archive: %s", filepath)
+}
+
+func readTar(filepath string, r io.Reader) (fs.FS, error) {
+	fsys := CreateMemFS()
+	reader := tar.NewReader(r)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return fsys, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid tar archive(%s): %s", filepath, err.Error())
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		content, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tar archive(%s): %s", filepath, err.Error())
+		}
+		fsys.AddFile(header.Name, content, header.ModTime)
+	}
+}
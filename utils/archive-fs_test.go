@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/fs"
+	"os"
+	fp "path/filepath"
+	"testing"
+	"time"
+)
+
+var archiveFiles = map[string]string{
+	"index.html":    "<html></html>",
+	"assets/app.js": "console.log(1)",
+}
+
+var archiveModTime = time.Date(2024, 1, 2, 3, 4, 6, 0, time.UTC)
+
+func createZip(t *testing.T) []byte {
+	buff := &bytes.Buffer{}
+	w := zip.NewWriter(buff)
+	for name, content := range archiveFiles {
+		f, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: archiveModTime})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	w.Close()
+	return buff.Bytes()
+}
+
+func createTar(t *testing.T) []byte {
+	buff := &bytes.Buffer{}
+	w := tar.NewWriter(buff)
+	w.WriteHeader(&tar.Header{Name: "assets/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: archiveModTime})
+	for name, content := range archiveFiles {
+		err := w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), ModTime: archiveModTime})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	w.Close()
+	return buff.Bytes()
+}
+
+func gzipped(content []byte) []byte {
+	buff := &bytes.Buffer{}
+	w := gzip.NewWriter(buff)
+	w.Write(content)
+	w.Close()
+	return buff.Bytes()
+}
+
+func TestOpenArchive(t *testing.T) {
+	tests := []struct {
+		name    string
+		content func(t *testing.T) []byte
+	}{
+		{"site.zip", createZip},
+		{"site.tar", createTar},
+		{"site.tar.gz", func(t *testing.T) []byte { return gzipped(createTar(t)) }},
+		{"SITE.TGZ", func(t *testing.T) []byte { return gzipped(createTar(t)) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := fp.Join(t.TempDir(), tt.name)
+			if err := os.WriteFile(path, tt.content(t), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			layer, err := OpenLayer(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if layer.Source != path || layer.Dir != "" {
+				t.Errorf("OpenLayer() = {Source: %q, Dir: %q}, want {Source: %q}", layer.Source, layer.Dir, path)
+			}
+
+			for name, content := range archiveFiles {
+				got, err := fs.ReadFile(layer.FS, name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != content {
+					t.Errorf("ReadFile(%q) = %q, want %q", name, got, content)
+				}
+				info, _ := fs.Stat(layer.FS, name)
+				if !info.ModTime().Equal(archiveModTime) {
+					t.Errorf("ModTime(%q) = %v, want %v", name, info.ModTime(), archiveModTime)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenArchiveErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"broken.zip":    "not a zip",
+		"broken.tar.gz": "not a gzip",
+		"site.rar":      "",
+	} {
+		path := fp.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0644)
+		if _, err := OpenLayer(path); err == nil {
+			t.Errorf("OpenLayer(%q) succeeded", name)
+		}
+	}
+	if _, err := OpenLayer(fp.Join(dir, "missing.zip")); err == nil {
+		t.Error("OpenLayer() of a missing file succeeded")
+	}
+}
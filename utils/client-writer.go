@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// number of messages waiting to be written to a client, a client
+	// that falls further behind is disconnected
+	clientQueueSize = 256
+	// time allowed to write a single message to a client
+	clientWriteWait = 10 * time.Second
+	// interval of the pings sent to the WebSocket clients
+	wsPingInterval = 20 * time.Second
+	// connections that didn't respond within this time are closed
+	wsPongWait = 2 * wsPingInterval
+	// interval of the comments sent to keep idle event streams
+	// from being closed by proxies
+	eventStreamKeepAlive = 15 * time.Second
+)
+
+// Each client has its own writer goroutine, fed through a bounded
+// queue, so a slow or stuck client doesn't hold back the broadcasts
+// to the other ones. Connections are not safe for concurrent writes,
+// the writer goroutine is the only one writing to its connection.
+
+func (client *WsClient) startWriter() {
+	client.queue = make(chan [][]byte, clientQueueSize)
+	client.done = make(chan struct{})
+	client.writerDone = make(chan struct{})
+	go client.writeLoop()
+}
+
+// encode returns the frames to write to the client for the message.
+func (client *WsClient) encode(id uint64, msg *HmrMessage) [][]byte {
+	if client.stream != nil {
+		return [][]byte{encodeEvent(id, "", msg.JSON())}
+	}
+	if client.Protocol >= 1 {
+		return [][]byte{msg.JSON()}
+	}
+
+	legacy := msg.Legacy()
+	frames := make([][]byte, len(legacy))
+	for i, m := range legacy {
+		frames[i] = []byte(m)
+	}
+	return frames
+}
+
+func encodeEvent(id uint64, event string, data []byte) []byte {
+	result := make([]byte, 0, len(data)+32)
+	if id > 0 {
+		result = fmt.Appendf(result, "id: %d\n", id)
+	}
+	if event != "" {
+		result = fmt.Appendf(result, "event: %s\n", event)
+	}
+	return fmt.Appendf(result, "data: %s\n\n", data)
+}
+
+// enqueue passes the frames to the writer goroutine without blocking,
+// the client is closed if its queue is full.
+func (client *WsClient) enqueue(frames [][]byte) bool {
+	select {
+	case <-client.done:
+		return false
+	default:
+	}
+
+	select {
+	case client.queue <- frames:
+		return true
+	default:
+		client.close()
+		return false
+	}
+}
+
+// close stops the writer goroutine, which closes the connection.
+func (client *WsClient) close() {
+	client.closeOnce.Do(func() {
+		close(client.done)
+	})
+}
+
+func (client *WsClient) writeLoop() {
+	defer close(client.writerDone)
+	if client.conn != nil {
+		// ends the read loop of the connection as well
+		defer client.conn.Close()
+	}
+
+	interval := wsPingInterval
+	if client.stream != nil {
+		interval = eventStreamKeepAlive
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-client.done:
+			return
+		case frames := <-client.queue:
+			for _, frame := range frames {
+				if err := client.writeFrame(frame); err != nil {
+					client.close()
+					return
+				}
+			}
+		case <-ticker.C:
+			if err := client.ping(); err != nil {
+				client.close()
+				return
+			}
+		}
+	}
+}
+
+func (client *WsClient) writeFrame(frame []byte) error {
+	deadline := time.Now().Add(clientWriteWait)
+
+	if client.stream != nil {
+		return client.stream.write(frame, deadline)
+	}
+
+	client.conn.SetWriteDeadline(deadline)
+	return client.conn.WriteMessage(websocket.TextMessage, frame)
+}
+
+func (client *WsClient) ping() error {
+	if client.stream != nil {
+		return client.stream.write([]byte(": keep-alive\n\n"), time.Now().Add(clientWriteWait))
+	}
+	// a connection that fails to respond hits the read deadline,
+	// which ends its read loop
+	return client.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(clientWriteWait))
+}
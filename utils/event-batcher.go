@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+type WatchEvent struct {
+	// one of HmrChanged, HmrCreated, HmrDeleted or HmrRenamed
+	Op      string
+	Path    string
+	OldPath string
+	// namespace of the watched directory the event comes from,
+	// empty for the served directory
+	Root string
+}
+
+// EventBatcher collects the watcher events until no new events arrive
+// for the duration of the window, and then passes all of them at once
+// to the flush callback, merging the events concerning the same file.
+type EventBatcher struct {
+	window  time.Duration
+	maxWait time.Duration
+	onFlush func([]WatchEvent)
+
+	pending    []WatchEvent
+	batchStart time.Time
+	timer      *time.Timer
+	mutex      *sync.Mutex
+}
+
+func CreateEventBatcher(window time.Duration, onFlush func([]WatchEvent)) *EventBatcher {
+	return &EventBatcher{
+		window: window,
+		// a constant stream of events should not delay the flush indefinitely
+		maxWait: window * 10,
+		onFlush: onFlush,
+		pending: make([]WatchEvent, 0),
+		mutex:   &sync.Mutex{},
+	}
+}
+
+func (b *EventBatcher) Push(event WatchEvent) {
+	if b.window <= 0 {
+		b.onFlush([]WatchEvent{event})
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(b.pending) == 0 {
+		b.batchStart = time.Now()
+	}
+	b.pending = mergeEvent(b.pending, event)
+
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+
+	wait := b.window
+	if remaining := b.maxWait - time.Since(b.batchStart); remaining < wait {
+		wait = max(remaining, 0)
+	}
+	b.timer = time.AfterFunc(wait, b.Flush)
+}
+
+func (b *EventBatcher) Flush() {
+	b.mutex.Lock()
+	events := b.pending
+	b.pending = make([]WatchEvent, 0)
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.mutex.Unlock()
+
+	if len(events) > 0 {
+		b.onFlush(events)
+	}
+}
+
+// Stop discards the pending events.
+func (b *EventBatcher) Stop() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.pending = make([]WatchEvent, 0)
+}
+
+// MergeEvents adds the new events to the list, the same way
+// the events pushed to the batcher are merged.
+func MergeEvents(events []WatchEvent, newEvents ...WatchEvent) []WatchEvent {
+	for _, event := range newEvents {
+		events = mergeEvent(events, event)
+	}
+	return events
+}
+
+func findEvent(events []WatchEvent, root string, path string) int {
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Root == root && events[i].Path == path {
+			return i
+		}
+	}
+	return -1
+}
+
+func removeEvent(events []WatchEvent, idx int) []WatchEvent {
+	return append(events[:idx], events[idx+1:]...)
+}
+
+// mergeEvent adds the event to the list, collapsing it with an
+// earlier event for the same file where possible.
+func mergeEvent(events []WatchEvent, event WatchEvent) []WatchEvent {
+	if event.Op == HmrRenamed {
+		idx := findEvent(events, event.Root, event.OldPath)
+		if idx != -1 && events[idx].Op == HmrCreated {
+			// file created and renamed within the window,
+			// for the clients it was created under the new name
+			events = removeEvent(events, idx)
+			return mergeEvent(events, WatchEvent{Op: HmrCreated, Path: event.Path, Root: event.Root})
+		}
+		return append(events, event)
+	}
+
+	idx := findEvent(events, event.Root, event.Path)
+	if idx == -1 {
+		return append(events, event)
+	}
+
+	prev := events[idx]
+	switch event.Op {
+	case HmrChanged:
+		switch prev.Op {
+		case HmrCreated, HmrChanged:
+			// already reported
+			return events
+		case HmrDeleted:
+			events[idx].Op = HmrChanged
+			return events
+		}
+	case HmrCreated:
+		if prev.Op == HmrDeleted {
+			events[idx].Op = HmrChanged
+			return events
+		}
+	case HmrDeleted:
+		switch prev.Op {
+		case HmrCreated:
+			// a temporary file, nothing to report
+			return removeEvent(events, idx)
+		case HmrChanged:
+			events[idx].Op = HmrDeleted
+			return events
+		}
+	}
+
+	return append(events, event)
+}
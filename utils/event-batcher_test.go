@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []WatchEvent
+		want   []WatchEvent
+	}{
+		{
+			name: "changed twice",
+			events: []WatchEvent{
+				{Op: HmrChanged, Path: "/src/a.ts"},
+				{Op: HmrChanged, Path: "/src/a.ts"},
+			},
+			want: []WatchEvent{{Op: HmrChanged, Path: "/src/a.ts"}},
+		},
+		{
+			name: "created then changed",
+			events: []WatchEvent{
+				{Op: HmrCreated, Path: "/src/a.ts"},
+				{Op: HmrChanged, Path: "/src/a.ts"},
+			},
+			want: []WatchEvent{{Op: HmrCreated, Path: "/src/a.ts"}},
+		},
+		{
+			name: "created then deleted",
+			events: []WatchEvent{
+				{Op: HmrCreated, Path: "/src/a.ts"},
+				{Op: HmrDeleted, Path: "/src/a.ts"},
+			},
+			want: []WatchEvent{},
+		},
+		{
+			name: "deleted then created",
+			events: []WatchEvent{
+				{Op: HmrDeleted, Path: "/src/a.ts"},
+				{Op: HmrCreated, Path: "/src/a.ts"},
+			},
+			want: []WatchEvent{{Op: HmrChanged, Path: "/src/a.ts"}},
+		},
+		{
+			name: "changed then deleted",
+			events: []WatchEvent{
+				{Op: HmrChanged, Path: "/src/a.ts"},
+				{Op: HmrDeleted, Path: "/src/a.ts"},
+			},
+			want: []WatchEvent{{Op: HmrDeleted, Path: "/src/a.ts"}},
+		},
+		{
+			name: "created then renamed",
+			events: []WatchEvent{
+				{Op: HmrCreated, Path: "/src/a.ts", Root: "src"},
+				{Op: HmrRenamed, Path: "/src/b.ts", OldPath: "/src/a.ts", Root: "src"},
+			},
+			want: []WatchEvent{{Op: HmrCreated, Path: "/src/b.ts", Root: "src"}},
+		},
+		{
+			name: "renamed over a deleted file",
+			events: []WatchEvent{
+				{Op: HmrCreated, Path: "/src/a.ts.tmp"},
+				{Op: HmrDeleted, Path: "/src/a.ts"},
+				{Op: HmrRenamed, Path: "/src/a.ts", OldPath: "/src/a.ts.tmp"},
+			},
+			want: []WatchEvent{{Op: HmrChanged, Path: "/src/a.ts"}},
+		},
+		{
+			name: "renamed without a create",
+			events: []WatchEvent{
+				{Op: HmrRenamed, Path: "/src/b.ts", OldPath: "/src/a.ts", Root: "src"},
+			},
+			want: []WatchEvent{{Op: HmrRenamed, Path: "/src/b.ts", OldPath: "/src/a.ts", Root: "src"}},
+		},
+		{
+			name: "same path in two roots",
+			events: []WatchEvent{
+				{Op: HmrCreated, Path: "a.ts"},
+				{Op: HmrDeleted, Path: "a.ts", Root: "src"},
+			},
+			want: []WatchEvent{
+				{Op: HmrCreated, Path: "a.ts"},
+				{Op: HmrDeleted, Path: "a.ts", Root: "src"},
+			},
+		},
+		{
+			name: "rename in another root",
+			events: []WatchEvent{
+				{Op: HmrCreated, Path: "a.ts"},
+				{Op: HmrRenamed, Path: "b.ts", OldPath: "a.ts", Root: "src"},
+			},
+			want: []WatchEvent{
+				{Op: HmrCreated, Path: "a.ts"},
+				{Op: HmrRenamed, Path: "b.ts", OldPath: "a.ts", Root: "src"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MergeEvents([]WatchEvent{}, tt.events...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergeEvents() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type historyEntry struct {
+	id     uint64
+	target *ClientTarget
+	msg    *HmrMessage
+}
+
+// messageHistory keeps the last broadcast messages, so that event
+// stream clients can receive the ones they missed while reconnecting.
+type messageHistory struct {
+	entries []historyEntry
+	size    int
+	lastId  uint64
+}
+
+func createMessageHistory(size int) *messageHistory {
+	return &messageHistory{
+		entries: make([]historyEntry, 0, size),
+		size:    size,
+	}
+}
+
+func (h *messageHistory) add(target *ClientTarget, msg *HmrMessage) uint64 {
+	h.lastId++
+	if len(h.entries) == h.size {
+		h.entries = h.entries[1:]
+	}
+	h.entries = append(h.entries, historyEntry{h.lastId, target, msg})
+	return h.lastId
+}
+
+// since returns the entries with an id greater than the given one.
+func (h *messageHistory) since(id uint64) []historyEntry {
+	for i, entry := range h.entries {
+		if entry.id > id {
+			return h.entries[i:]
+		}
+	}
+	return nil
+}
+
+// eventStream is the connection of a client using Server-Sent Events,
+// for environments where WebSocket connections cannot be established.
+type eventStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	rc      *http.ResponseController
+}
+
+func (s *eventStream) write(data []byte, deadline time.Time) error {
+	// not supported by every response writer, in which case
+	// the write simply has no deadline
+	s.rc.SetWriteDeadline(deadline)
+
+	_, err := s.w.Write(data)
+	if err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// lastEventId returns the id of the last message received by the
+// reconnecting client, from the `Last-Event-ID` header set by the
+// browsers or the `lastEventId` query parameter.
+func lastEventId(req *http.Request) (uint64, bool) {
+	value := req.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = req.URL.Query().Get("lastEventId")
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	return id, err == nil
+}
+
+// AddEventStream serves the HMR messages to the client as a
+// `text/event-stream` response, blocking until the client disconnects
+// or the controller is closed.
+//
+// The stream starts with a `connected` event carrying the client id,
+// which the client uses to send its messages over HTTP, and the boot
+// id of the server. The onConnect
+// callback, if given, is called once the client was added.
+func (controller *WsController) AddEventStream(w http.ResponseWriter, req *http.Request, onConnect func(*WsClient)) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return fmt.Errorf("streaming is not supported by the response writer")
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// disables response buffering in nginx
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	stream := &eventStream{
+		w:       w,
+		flusher: flusher,
+		rc:      http.NewResponseController(w),
+	}
+
+	client := &WsClient{
+		Transport:   TransportEventStream,
+		RemoteAddr:  req.RemoteAddr,
+		UserAgent:   req.UserAgent(),
+		ConnectedAt: time.Now(),
+		// event streams were added after the JSON protocol
+		Protocol:  max(requestedProtocol(req), 1),
+		stream:    stream,
+		closeOnce: &sync.Once{},
+	}
+	client.startWriter()
+	controller.register(client, req)
+
+	defer controller.removeClient(func(c *WsClient) bool {
+		return c == client
+	})
+
+	if onConnect != nil {
+		onConnect(client)
+	}
+
+	select {
+	case <-req.Context().Done():
+		client.close()
+	case <-client.done:
+	}
+
+	// the response writer cannot be used after the handler returns
+	<-client.writerDone
+	return nil
+}
@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEvent reads the lines of the next event of the stream,
+// skipping the keep-alive comments.
+func readEvent(t *testing.T, r *bufio.Reader) []string {
+	lines := []string{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if len(lines) > 0 {
+				return lines
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, ":") {
+			lines = append(lines, line)
+		}
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		query  string
+		want   [][]string
+	}{
+		{
+			name: "new client",
+			want: [][]string{
+				{"id: 4", `data: {"v":1,"type":"changed","id":4,"path":"/d.js"}`},
+			},
+		},
+		{
+			name:   "Last-Event-ID header",
+			header: "1",
+			want: [][]string{
+				{"id: 3", `data: {"v":1,"type":"changed","id":3,"path":"/c.css"}`},
+				{"id: 4", `data: {"v":1,"type":"changed","id":4,"path":"/d.js"}`},
+			},
+		},
+		{
+			name:  "lastEventId parameter",
+			query: "?lastEventId=0",
+			want: [][]string{
+				{"id: 1", `data: {"v":1,"type":"changed","id":1,"path":"/a.js"}`},
+				{"id: 3", `data: {"v":1,"type":"changed","id":3,"path":"/c.css"}`},
+				{"id: 4", `data: {"v":1,"type":"changed","id":4,"path":"/d.js"}`},
+			},
+		},
+		{
+			name:   "header before parameter",
+			header: "2",
+			query:  "?lastEventId=0",
+			want: [][]string{
+				{"id: 3", `data: {"v":1,"type":"changed","id":3,"path":"/c.css"}`},
+				{"id: 4", `data: {"v":1,"type":"changed","id":4,"path":"/d.js"}`},
+			},
+		},
+		{
+			name:  "restarted server",
+			query: "?lastEventId=0&bootId=other",
+			want: [][]string{
+				{"id: 4", `data: {"v":1,"type":"changed","id":4,"path":"/d.js"}`},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := CreateWsController()
+			connected := make(chan *WsClient, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				controller.AddEventStream(w, r, func(client *WsClient) {
+					connected <- client
+				})
+			}))
+			defer server.Close()
+
+			controller.SendToAll(&HmrMessage{Type: HmrChanged, Path: "/a.js"})
+			// sent to the clients of another page only
+			controller.SendTo(&ClientTarget{Pages: []string{"/other.html"}}, &HmrMessage{Type: HmrChanged, Path: "/b.js"})
+			controller.SendToAll(&HmrMessage{Type: HmrChanged, Path: "/c.css"})
+
+			req, _ := http.NewRequest("GET", server.URL+tt.query, nil)
+			if tt.header != "" {
+				req.Header.Set("Last-Event-ID", tt.header)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+
+			client := <-connected
+			if client.Transport != TransportEventStream || client.Protocol != HmrProtocolVersion {
+				t.Errorf("client = %+v", client)
+			}
+
+			r := bufio.NewReader(res.Body)
+			first := readEvent(t, r)
+			if len(first) != 2 || first[0] != "event: connected" || !strings.Contains(first[1], `"bootId":"`+controller.BootId+`"`) {
+				t.Errorf("first event = %q, want the connected event", first)
+			}
+
+			// sent after the missed messages
+			controller.SendToAll(&HmrMessage{Type: HmrChanged, Path: "/d.js"})
+
+			got := [][]string{}
+			for range tt.want {
+				got = append(got, readEvent(t, r))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+
+			// the client is removed once it disconnects
+			res.Body.Close()
+			waitFor(t, "the client to be removed", func() bool { return controller.Count() == 0 })
+		})
+	}
+}
+
+func TestEventStreamClosedByController(t *testing.T) {
+	controller := CreateWsController()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		controller.AddEventStream(w, r, nil)
+	}))
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	readEvent(t, bufio.NewReader(res.Body))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// reads until the server ends the response
+		for {
+			if _, err := res.Body.Read(make([]byte, 64)); err != nil {
+				return
+			}
+		}
+	}()
+
+	controller.CloseAll()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the stream was not ended by CloseAll()")
+	}
+}
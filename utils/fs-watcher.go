@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"fmt"
+	fp "path/filepath"
+	"time"
+)
+
+const (
+	WatchModeNative = "native"
+	WatchModePoll   = "poll"
+)
+
+// FsWatcher recursively watches a directory and reports
+// the changes to the files within it.
+type FsWatcher interface {
+	Events() <-chan WatchEvent
+	Errors() <-chan error
+	Close()
+}
+
+// CreateFsWatcher starts watching the directory using the backend
+// selected by the mode. The native backend is event-driven, the poll
+// backend scans the whole directory tree every interval, which is
+// slower but works on filesystems that don't support change
+// notifications (e.g. network filesystems).
+//
+// Files not allowed by the filter are not reported, and ignored
+// directories are not traversed at all where the backend allows it.
+func CreateFsWatcher(mode string, dir string, pollInterval time.Duration, filter *WatchFilter) (FsWatcher, error) {
+	switch mode {
+	case WatchModeNative, "":
+		return createNativeWatcher(dir, pollInterval, filter)
+	case WatchModePoll:
+		return createPollWatcher(dir, pollInterval, filter)
+	}
+	return nil, fmt.Errorf("unknown watch mode: %s", mode)
+}
+
+// filterEvent applies the filter to the event, a rename from or to
+// a file that is not allowed becomes a create or delete event.
+func filterEvent(filter *WatchFilter, root string, event WatchEvent) (WatchEvent, bool) {
+	if filter == nil {
+		return event, true
+	}
+
+	relPath, _ := fp.Rel(root, event.Path)
+	allowed := filter.Allows(relPath)
+
+	if event.Op == HmrRenamed {
+		oldRelPath, _ := fp.Rel(root, event.OldPath)
+		oldAllowed := filter.Allows(oldRelPath)
+
+		switch {
+		case allowed && !oldAllowed:
+			return WatchEvent{Op: HmrCreated, Path: event.Path}, true
+		case !allowed && oldAllowed:
+			return WatchEvent{Op: HmrDeleted, Path: event.OldPath}, true
+		}
+	}
+
+	return event, allowed
+}
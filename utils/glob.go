@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"path"
+	"strings"
+)
+
+// MatchGlob reports whether the slash separated path matches the
+// pattern. Besides the `path.Match` syntax, a `**` segment matches any
+// number of directories. A pattern without any slashes is matched
+// against each segment of the path, so `node_modules` or `*.map`
+// match at any depth.
+func MatchGlob(pattern string, p string) bool {
+	pattern = strings.TrimPrefix(pattern, "./")
+	pattern = strings.TrimSuffix(pattern, "/")
+	pathParts := strings.Split(p, "/")
+
+	if !strings.Contains(pattern, "/") {
+		for _, part := range pathParts {
+			if ok, _ := path.Match(pattern, part); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	return matchParts(strings.Split(pattern, "/"), pathParts)
+}
+
+func matchParts(pattern []string, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			for i := 0; i <= len(parts); i++ {
+				if matchParts(rest, parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		parts = parts[1:]
+	}
+
+	// a pattern matching a directory matches everything inside it
+	return true
+}
+
+// WatchFilter decides which files within a watched directory
+// are reported, based on the include and ignore glob patterns.
+type WatchFilter struct {
+	Include []string
+	Ignore  []string
+}
+
+// IsIgnored reports whether the path (relative to the watched
+// directory) matches any of the ignore patterns.
+func (f *WatchFilter) IsIgnored(relPath string) bool {
+	if f == nil {
+		return false
+	}
+	relPath = path.Clean(strings.ReplaceAll(relPath, "\\", "/"))
+	for _, pattern := range f.Ignore {
+		if MatchGlob(pattern, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether changes to the file under the path
+// (relative to the watched directory) should be reported.
+func (f *WatchFilter) Allows(relPath string) bool {
+	if f == nil {
+		return true
+	}
+	if f.IsIgnored(relPath) {
+		return false
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	relPath = path.Clean(strings.ReplaceAll(relPath, "\\", "/"))
+	for _, pattern := range f.Include {
+		if MatchGlob(pattern, relPath) {
+			return true
+		}
+	}
+	return false
+}
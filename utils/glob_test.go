@@ -0,0 +1,66 @@
+package utils
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.map", "app.js.map", true},
+		{"*.map", "js/vendor/app.js.map", true},
+		{"*.map", "app.js", false},
+		{"node_modules", "node_modules/pkg/index.js", true},
+		{"node_modules", "src/node_modules/pkg/index.js", true},
+		{"node_modules", "src/node_modules_old/index.js", false},
+		{"src/*.ts", "src/app.ts", true},
+		{"src/*.ts", "src/lib/app.ts", false},
+		{"./src/*.ts", "src/app.ts", true},
+		{"src/**", "src/lib/app.ts", true},
+		{"src/**", "lib/app.ts", false},
+		{"src/**/*.ts", "src/app.ts", true},
+		{"src/**/*.ts", "src/a/b/app.ts", true},
+		{"src/**/*.ts", "src/a/b/app.js", false},
+		{"**/test/*.js", "test/a.js", true},
+		{"**/test/*.js", "a/b/test/a.js", true},
+		{"dist/", "dist/app.js", true},
+		{"src/lib", "src/lib/a/b.ts", true},
+		{"src/lib", "src/library/b.ts", false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchGlob(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("MatchGlob(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestWatchFilter(t *testing.T) {
+	filter := &WatchFilter{
+		Include: []string{"*.ts", "*.css"},
+		Ignore:  []string{"node_modules", "*.d.ts"},
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"src/app.ts", true},
+		{"styles/main.css", true},
+		{"src/app.js", false},
+		{"src/types.d.ts", false},
+		{"node_modules/pkg/index.ts", false},
+		{"src\\app.ts", true},
+	}
+	for _, tt := range tests {
+		if got := filter.Allows(tt.path); got != tt.want {
+			t.Errorf("Allows(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	var none *WatchFilter
+	if !none.Allows("a.js") || none.IsIgnored("a.js") {
+		t.Error("a nil filter should allow all files")
+	}
+}
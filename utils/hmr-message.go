@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+)
+
+// Latest version of the JSON HMR protocol. Clients request it by
+// connecting with a `v` query parameter, clients that don't are sent
+// messages in the legacy `<type>:<path>` string format.
+const HmrProtocolVersion = 1
+
+const (
+	HmrChanged           = "changed"
+	HmrCreated           = "created"
+	HmrDeleted           = "deleted"
+	HmrRenamed           = "renamed"
+	HmrDependencyChanged = "depchanged"
+	HmrCustom            = "custom"
+	HmrBatch             = "batch"
+	HmrError             = "error"
+	HmrErrorCleared      = "errorcleared"
+	HmrConnected         = "connected"
+)
+
+// types of the messages sent by the clients
+const (
+	HmrClientHello       = "hello"
+	HmrClientSubscribe   = "subscribe"
+	HmrClientUnsubscribe = "unsubscribe"
+)
+
+type HmrMessage struct {
+	V    int    `json:"v"`
+	Type string `json:"type"`
+	// sequence number of the broadcast message, sent back by the
+	// reconnecting clients to receive the messages they missed
+	Id      uint64 `json:"id,omitempty"`
+	Path    string `json:"path,omitempty"`
+	OldPath string `json:"oldPath,omitempty"`
+	// namespace of the additional watched directory the paths are
+	// relative to, empty for the served directory
+	Root string `json:"root,omitempty"`
+	// page that depends on the changed file, for `depchanged` messages
+	Page string `json:"page,omitempty"`
+	// modification time in unix milliseconds
+	Mtime int64  `json:"mtime,omitempty"`
+	Size  int64  `json:"size,omitempty"`
+	Etag  string `json:"etag,omitempty"`
+	Batch string `json:"batch,omitempty"`
+	// payload of `custom` messages, or the error text of `error` messages
+	Data string `json:"data,omitempty"`
+	// location of the error, for `error` messages
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+	// messages included in a `batch` message
+	Events []*HmrMessage `json:"events,omitempty"`
+	// sent in the `connected` message, the boot id changes each time
+	// the server is started
+	BootId   string `json:"bootId,omitempty"`
+	ClientId uint64 `json:"clientId,omitempty"`
+}
+
+// HmrClientMessage is a message sent by a client. With `hello` the
+// client identifies the page it's on and the groups it belongs to,
+// `subscribe` and `unsubscribe` change the path patterns it wants
+// to receive the file events for.
+type HmrClientMessage struct {
+	Type     string   `json:"type"`
+	Page     string   `json:"page,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+	Patterns []string `json:"patterns,omitempty"`
+}
+
+// IsFileEvent reports whether the message concerns a single file.
+func (m *HmrMessage) IsFileEvent() bool {
+	switch m.Type {
+	case HmrChanged, HmrCreated, HmrDeleted, HmrRenamed, HmrDependencyChanged:
+		return true
+	}
+	return false
+}
+
+// FullPath returns the path of the file prefixed with
+// the namespace of its root directory.
+func (m *HmrMessage) FullPath() string {
+	if m.Root != "" {
+		return path.Join(m.Root, m.Path)
+	}
+	return m.Path
+}
+
+func (m *HmrMessage) JSON() []byte {
+	b, _ := json.Marshal(m.versioned())
+	return b
+}
+
+// versioned returns a copy of the message, including the messages
+// of a batch, with the protocol version set.
+func (m *HmrMessage) versioned() *HmrMessage {
+	c := *m
+	c.V = HmrProtocolVersion
+	if m.Events != nil {
+		c.Events = make([]*HmrMessage, len(m.Events))
+		for i, ev := range m.Events {
+			c.Events[i] = ev.versioned()
+		}
+	}
+	return &c
+}
+
+// Legacy returns the message in the string format used before
+// the JSON protocol was introduced. Batches are split into
+// separate messages.
+func (m *HmrMessage) Legacy() []string {
+	if m.Type == HmrBatch {
+		result := make([]string, 0, len(m.Events))
+		for _, ev := range m.Events {
+			result = append(result, ev.Legacy()...)
+		}
+		return result
+	}
+	return []string{m.legacy()}
+}
+
+func (m *HmrMessage) legacy() string {
+	p := m.Path
+	oldP := m.OldPath
+	if m.Root != "" {
+		p = path.Join(m.Root, p)
+		oldP = path.Join(m.Root, oldP)
+	}
+
+	switch m.Type {
+	case HmrRenamed:
+		return fmt.Sprintf("renamed:%s:%s", oldP, p)
+	case HmrDependencyChanged:
+		return fmt.Sprintf("depchanged:%s\n%s", m.Page, p)
+	case HmrCustom:
+		return "custom:" + m.Data
+	case HmrError:
+		return "error:" + m.Data
+	case HmrErrorCleared:
+		return "errorcleared:"
+	default:
+		return fmt.Sprintf("%s:%s", m.Type, p)
+	}
+}
@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"bytes"
+)
+
+// elements whose content is not parsed as html, a `</head>` within
+// them is not a tag
+var rawTextElements = []string{"script", "style", "textarea", "title", "xmp"}
+
+// hasTagPrefix reports whether the data starts with the given tag
+// opening (e.g. `<body` or `</head`), case-insensitively, followed by
+// the end of the tag name.
+func hasTagPrefix(data []byte, tag string) bool {
+	if len(data) < len(tag) || !bytes.EqualFold(data[:len(tag)], []byte(tag)) {
+		return false
+	}
+	if len(data) == len(tag) {
+		return true
+	}
+	switch data[len(tag)] {
+	case '>', '/', ' ', '\t', '\n', '\r', '\f':
+		return true
+	}
+	return false
+}
+
+// indexFold returns the index of the first case-insensitive occurrence
+// of the ASCII needle in data, or -1.
+func indexFold(data []byte, needle string) int {
+	n := len(needle)
+	for i := 0; i+n <= len(data); i++ {
+		if bytes.EqualFold(data[i:i+n], []byte(needle)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// FindHeadInjectionPoint returns the offset in the html document at
+// which the content meant for the document head should be inserted.
+// That's the closing `</head>` tag, or if there is none, right after
+// the opening `<body>` tag, before the closing `</body>` or `</html>`
+// tags, or the end of the document, in this order. Tags are matched
+// case-insensitively, and the ones within comments, scripts and other
+// raw text elements are skipped.
+func FindHeadInjectionPoint(html []byte) int {
+	bodyStart, bodyEnd, htmlEnd := -1, -1, -1
+
+	i := 0
+	for {
+		lt := bytes.IndexByte(html[i:], '<')
+		if lt == -1 {
+			break
+		}
+		i += lt
+		rest := html[i:]
+
+		if bytes.HasPrefix(rest, []byte("<!--")) {
+			end := bytes.Index(rest[4:], []byte("-->"))
+			if end == -1 {
+				break
+			}
+			i += 4 + end + 3
+			continue
+		}
+
+		skipped := false
+		for _, name := range rawTextElements {
+			if hasTagPrefix(rest, "<"+name) {
+				end := indexFold(rest[1:], "</"+name)
+				if end == -1 {
+					i = len(html)
+				} else {
+					i += 1 + end + 2 + len(name)
+				}
+				skipped = true
+				break
+			}
+		}
+		if skipped {
+			continue
+		}
+
+		switch {
+		case hasTagPrefix(rest, "</head"):
+			return i
+		case bodyStart == -1 && hasTagPrefix(rest, "<body"):
+			end := bytes.IndexByte(rest, '>')
+			if end == -1 {
+				bodyStart = len(html)
+			} else {
+				bodyStart = i + end + 1
+			}
+		case hasTagPrefix(rest, "</body"):
+			bodyEnd = i
+		case hasTagPrefix(rest, "</html"):
+			htmlEnd = i
+		}
+		i++
+	}
+
+	switch {
+	case bodyStart != -1:
+		return bodyStart
+	case bodyEnd != -1:
+		return bodyEnd
+	case htmlEnd != -1:
+		return htmlEnd
+	}
+	return len(html)
+}
+
+// InjectIntoHead returns a copy of the html document with the content
+// inserted at the point returned by FindHeadInjectionPoint.
+func InjectIntoHead(html []byte, content []byte) []byte {
+	return InjectAt(html, FindHeadInjectionPoint(html), content)
+}
+
+// InjectAt returns a copy of the html document with the content
+// inserted at the given offset.
+func InjectAt(html []byte, idx int, content []byte) []byte {
+	result := make([]byte, 0, len(html)+len(content))
+	result = append(result, html[:idx]...)
+	result = append(result, content...)
+	result = append(result, html[idx:]...)
+	return result
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindHeadInjectionPoint(t *testing.T) {
+	// the `|` marks the expected injection point
+	tests := []struct {
+		name string
+		html string
+	}{
+		{"closing head", "<html><head><title>a</title>|</head><body></body></html>"},
+		{"uppercase tags", "<HTML><HEAD>|</HEAD><BODY></BODY></HTML>"},
+		{"head with attributes", "<head><meta charset=utf-8>|</head >"},
+		{"no head", "<html><body class=\"a\">|<p>a</p></body></html>"},
+		{"no body tag", "<html><p>a</p>|</body></html>"},
+		{"only closing html", "<p>a</p>|</html>"},
+		{"fragment", "<p>a</p>|"},
+		{"empty", "|"},
+		{"head in a comment", "<!-- </head> --><body>|</body>"},
+		{"head in a script", "<head><script>document.write('</head>')</script>|</head>"},
+		{"head in a title", "<head><title></head></title>|</head>"},
+		{"unclosed script", "<body>|<script>let a = '</head>'"},
+		{"unclosed comment", "<body>|<!-- </head>"},
+		{"similar tag names", "<header></header><bodyx><body>|</body>"},
+		{"unclosed body tag", "<body class=a|"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := strings.Index(tt.html, "|")
+			html := strings.Replace(tt.html, "|", "", 1)
+			if got := FindHeadInjectionPoint([]byte(html)); got != want {
+				t.Errorf("FindHeadInjectionPoint() = %d, want %d (%q)", got, want, html[:got]+"|"+html[got:])
+			}
+		})
+	}
+}
+
+func TestInjectIntoHead(t *testing.T) {
+	got := string(InjectIntoHead([]byte("<head></head>"), []byte("<script></script>")))
+	if want := "<head><script></script></head>"; got != want {
+		t.Errorf("InjectIntoHead() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemFS is a read-only filesystem keeping the files in memory, e.g.
+// the files extracted from a tar archive, or the files generated by
+// an app embedding the server. The directories are implied by the
+// paths of the files.
+type MemFS struct {
+	mutex *sync.RWMutex
+	files map[string]*memFileInfo
+}
+
+func CreateMemFS() *MemFS {
+	return &MemFS{
+		mutex: &sync.RWMutex{},
+		files: make(map[string]*memFileInfo),
+	}
+}
+
+type memFileInfo struct {
+	name    string
+	content []byte
+	modTime time.Time
+	dir     bool
+}
+
+func (i *memFileInfo) Name() string       { return path.Base(i.name) }
+func (i *memFileInfo) Size() int64        { return int64(len(i.content)) }
+func (i *memFileInfo) ModTime() time.Time { return i.modTime }
+func (i *memFileInfo) IsDir() bool        { return i.dir }
+func (i *memFileInfo) Sys() any           { return nil }
+
+func (i *memFileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// AddFile adds the file under the given slash-separated path,
+// replacing the previous one.
+func (m *MemFS) AddFile(name string, content []byte, modTime time.Time) {
+	name = cleanRelPath(name)
+	if name == "" {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.files[name] = &memFileInfo{name: name, content: content, modTime: modTime}
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if file, ok := m.files[name]; ok {
+		return file, nil
+	}
+	if name == "." {
+		return &memFileInfo{name: name, dir: true}, nil
+	}
+	prefix := name + "/"
+	for filename := range m.files {
+		if strings.HasPrefix(filename, prefix) {
+			return &memFileInfo{name: name, dir: true}, nil
+		}
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	info, err := m.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	prefix := ""
+	if name != "." {
+		prefix = name + "/"
+	}
+	children := map[string]*memFileInfo{}
+	for filename, file := range m.files {
+		rest, ok := strings.CutPrefix(filename, prefix)
+		if !ok {
+			continue
+		}
+		if child, _, isDir := strings.Cut(rest, "/"); isDir {
+			children[child] = &memFileInfo{name: prefix + child, dir: true}
+		} else {
+			children[child] = file
+		}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(children))
+	for _, child := range children {
+		entries = append(entries, fs.FileInfoToDirEntry(child))
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return entries, nil
+}
+
+func (m *MemFS) Open(name string) (fs.File, error) {
+	info, err := m.Stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err.(*fs.PathError).Err}
+	}
+	file := info.(*memFileInfo)
+	if file.dir {
+		return &memDir{info: file, fsys: m}, nil
+	}
+	return &memFile{info: file, reader: bytes.NewReader(file.content)}, nil
+}
+
+type memFile struct {
+	info   *memFileInfo
+	reader *bytes.Reader
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error)                   { return f.info, nil }
+func (f *memFile) Read(b []byte) (int, error)                   { return f.reader.Read(b) }
+func (f *memFile) Seek(offset int64, whence int) (int64, error) { return f.reader.Seek(offset, whence) }
+func (f *memFile) Close() error                                 { return nil }
+
+type memDir struct {
+	info    *memFileInfo
+	fsys    *MemFS
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *memDir) Close() error               { return nil }
+
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+func (d *memDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.fsys.ReadDir(d.info.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.read = true
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestMemFS(t *testing.T) {
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	fsys := CreateMemFS()
+	fsys.AddFile("index.html", []byte("<html></html>"), modTime)
+	fsys.AddFile("js/app.js", []byte("console.log(1)"), modTime)
+	fsys.AddFile("js/lib/util.js", []byte("export {}"), modTime)
+	fsys.AddFile("/css/../css/style.css", []byte("body {}"), modTime)
+
+	err := fstest.TestFS(fsys, "index.html", "js/app.js", "js/lib/util.js", "css/style.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := fs.Stat(fsys, "js/app.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(modTime) || info.Size() != 14 {
+		t.Errorf("Stat() = %v %d, want %v 14", info.ModTime(), info.Size(), modTime)
+	}
+
+	for _, name := range []string{"missing.js", "js/app", "../index.html"} {
+		if _, err := fsys.Open(name); err == nil {
+			t.Errorf("Open(%q) succeeded", name)
+		}
+	}
+	if _, err := fsys.Open("missing.js"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open() error = %v, want fs.ErrNotExist", err)
+	}
+}
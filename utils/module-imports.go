@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+)
+
+// ImportSpecifier is a string literal module specifier found in
+// a JavaScript source, Start and End are the offsets of its value,
+// without the quotes.
+type ImportSpecifier struct {
+	Value   string
+	Start   int
+	End     int
+	Dynamic bool
+}
+
+// IsLocal reports whether the specifier points to a file on the same
+// server (relative or root-relative), bare specifiers and full URLs
+// are resolved by the browser or an import map.
+func (s *ImportSpecifier) IsLocal() bool {
+	v := s.Value
+	if strings.HasPrefix(v, "./") || strings.HasPrefix(v, "../") {
+		return true
+	}
+	return strings.HasPrefix(v, "/") && !strings.HasPrefix(v, "//")
+}
+
+func isIdentByte(b byte) bool {
+	return b == '_' || b == '$' || b == '.' ||
+		(b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9') ||
+		b >= 0x80
+}
+
+func isSpaceByte(b byte) bool {
+	switch b {
+	case ' ', '\t', '\n', '\r', '\f', '\v':
+		return true
+	}
+	return false
+}
+
+// hasKeywordAt reports whether the keyword is at the offset, as
+// a separate word.
+func hasKeywordAt(src []byte, i int, keyword string) bool {
+	if !bytes.HasPrefix(src[i:], []byte(keyword)) {
+		return false
+	}
+	if i > 0 && isIdentByte(src[i-1]) {
+		return false
+	}
+	end := i + len(keyword)
+	return end == len(src) || !isIdentByte(src[end])
+}
+
+// keywordBefore reports whether the keyword ends right before the
+// offset, ignoring whitespace.
+func keywordBefore(src []byte, i int, keyword string) bool {
+	start := lastNonSpace(src, i) - len(keyword)
+	return start >= 0 && hasKeywordAt(src, start, keyword)
+}
+
+// FindImportSpecifiers scans the JavaScript source for the specifiers
+// of the import and export statements and of the dynamic imports with
+// a string literal argument. The second return value reports whether
+// the source uses the ES module syntax (static imports or exports, or
+// `import.meta`), which is not allowed in classic scripts.
+//
+// This is not a full parser, comments, strings and template literals
+// are skipped, but a quote within a regular expression literal can
+// throw it off.
+func FindImportSpecifiers(src []byte) ([]ImportSpecifier, bool) {
+	specifiers := []ImportSpecifier{}
+	isModule := false
+
+	for i := 0; i < len(src); i++ {
+		b := src[i]
+		switch {
+		case b == '/' && i+1 < len(src) && src[i+1] == '/':
+			end := bytes.IndexByte(src[i:], '\n')
+			if end == -1 {
+				return specifiers, isModule
+			}
+			i += end
+		case b == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end == -1 {
+				return specifiers, isModule
+			}
+			i += 2 + end + 1
+		case b == '`':
+			end := skipString(src, i)
+			i = end
+		case b == '"' || b == '\'':
+			end := skipString(src, i)
+			if end >= len(src) {
+				return specifiers, isModule
+			}
+			if src[end] != b {
+				i = end
+				continue
+			}
+
+			spec := ImportSpecifier{
+				Value: string(src[i+1 : end]),
+				Start: i + 1,
+				End:   end,
+			}
+			if keywordBefore(src, i, "from") || keywordBefore(src, i, "import") {
+				specifiers = append(specifiers, spec)
+				isModule = true
+			} else if j := lastNonSpace(src, i); j > 0 && src[j-1] == '(' {
+				if keywordBefore(src, j-1, "import") && isCallEnd(src, end+1) {
+					spec.Dynamic = true
+					specifiers = append(specifiers, spec)
+				}
+			}
+			i = end
+		case b == 'e' && hasKeywordAt(src, i, "export"):
+			isModule = true
+			i += len("export") - 1
+		case b == 'i' && bytes.HasPrefix(src[i:], []byte("import.meta")) && (i == 0 || !isIdentByte(src[i-1])):
+			isModule = true
+			i += len("import.meta") - 1
+		}
+	}
+
+	return specifiers, isModule
+}
+
+// skipString returns the offset of the quote closing the string
+// literal starting at the offset.
+func skipString(src []byte, start int) int {
+	quote := src[start]
+	for i := start + 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case quote:
+			return i
+		case '\n':
+			if quote != '`' {
+				// unterminated string
+				return i
+			}
+		}
+	}
+	return len(src)
+}
+
+func lastNonSpace(src []byte, i int) int {
+	for i > 0 && isSpaceByte(src[i-1]) {
+		i--
+	}
+	return i
+}
+
+// isCallEnd reports whether the dynamic import call ends after its
+// first argument, `import("./a.js" + name)` cannot be rewritten.
+func isCallEnd(src []byte, i int) bool {
+	for i < len(src) && isSpaceByte(src[i]) {
+		i++
+	}
+	return i < len(src) && (src[i] == ')' || src[i] == ',')
+}
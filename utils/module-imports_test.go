@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindImportSpecifiers(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		want     []string
+		dynamic  []bool
+		isModule bool
+	}{
+		{
+			name:     "static imports",
+			src:      "import a from \"./a.js\";\nimport { b } from './b.js';\nimport './c.css';",
+			want:     []string{"./a.js", "./b.js", "./c.css"},
+			isModule: true,
+		},
+		{
+			name:     "exports",
+			src:      "export * from \"../lib/index.js\";\nexport { x } from '/x.js';",
+			want:     []string{"../lib/index.js", "/x.js"},
+			isModule: true,
+		},
+		{
+			name:     "multiline import",
+			src:      "import {\n  a,\n  b,\n} from\n  \"./ab.js\";",
+			want:     []string{"./ab.js"},
+			isModule: true,
+		},
+		{
+			name:    "dynamic import in a classic script",
+			src:     "const m = await import(\"./lazy.js\");",
+			want:    []string{"./lazy.js"},
+			dynamic: []bool{true},
+		},
+		{
+			name:    "dynamic import with options",
+			src:     "import('./data.json', { with: { type: 'json' } })",
+			want:    []string{"./data.json"},
+			dynamic: []bool{true},
+		},
+		{
+			name: "computed dynamic import",
+			src:  "import(\"./pages/\" + name + \".js\")",
+			want: []string{},
+		},
+		{
+			name: "strings and comments",
+			src:  "// import a from './a.js'\n/* import b from './b.js' */\nconst s = \"from './c.js'\";\nconst t = `import './d.js'`;",
+			want: []string{},
+		},
+		{
+			name: "not keywords",
+			src:  "const reimport = 1; x.import('./a.js'); fromage('./b.js');",
+			want: []string{},
+		},
+		{
+			name:     "import.meta",
+			src:      "console.log(import.meta.url);",
+			want:     []string{},
+			isModule: true,
+		},
+		{
+			name:     "escaped quote",
+			src:      "import a from './it\\'s.js';",
+			want:     []string{"./it\\'s.js"},
+			isModule: true,
+		},
+		{
+			name: "unterminated string",
+			src:  "import a from './a.js",
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			specifiers, isModule := FindImportSpecifiers([]byte(tt.src))
+			if isModule != tt.isModule {
+				t.Errorf("isModule = %v, want %v", isModule, tt.isModule)
+			}
+
+			got := []string{}
+			dynamic := []bool{}
+			for _, spec := range specifiers {
+				got = append(got, spec.Value)
+				dynamic = append(dynamic, spec.Dynamic)
+				if tt.src[spec.Start:spec.End] != spec.Value {
+					t.Errorf("offsets of %q point to %q", spec.Value, tt.src[spec.Start:spec.End])
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindImportSpecifiers() = %q, want %q", got, tt.want)
+			}
+			if tt.dynamic != nil && !reflect.DeepEqual(dynamic, tt.dynamic) {
+				t.Errorf("Dynamic = %v, want %v", dynamic, tt.dynamic)
+			}
+		})
+	}
+}
+
+func TestImportSpecifierIsLocal(t *testing.T) {
+	tests := map[string]bool{
+		"./a.js":                 true,
+		"../a.js":                true,
+		"/a.js":                  true,
+		"//cdn.example.com/a.js": false,
+		"https://example.com/a":  false,
+		"lodash":                 false,
+		".hidden.js":             false,
+	}
+	for value, want := range tests {
+		spec := ImportSpecifier{Value: value}
+		if got := spec.IsLocal(); got != want {
+			t.Errorf("IsLocal(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	fp "path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE |
+	syscall.IN_CLOSE_WRITE |
+	syscall.IN_ATTRIB |
+	syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM |
+	syscall.IN_MOVED_TO |
+	syscall.IN_DELETE_SELF
+
+// inotifyWatcher is the native backend for Linux. Inotify watches are
+// not recursive, so a watch is added for every directory in the tree,
+// including the ones created after the watcher was started.
+type inotifyWatcher struct {
+	root   string
+	filter *WatchFilter
+	fd     int
+	file   *os.File
+	events chan WatchEvent
+	errors chan error
+
+	mutex *sync.Mutex
+	// watch descriptor -> directory path
+	watches map[int32]string
+	// directory path -> watch descriptor
+	paths map[string]int32
+	// the files in the watched tree, a file moved over one of
+	// them is reported as changed, the way editors save files
+	files map[string]bool
+}
+
+func createNativeWatcher(dir string, pollInterval time.Duration, filter *WatchFilter) (FsWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize inotify: %w", err)
+	}
+
+	iw := &inotifyWatcher{
+		root:   dir,
+		filter: filter,
+		fd:     fd,
+		// a non-blocking fd is handled by the runtime poller, which
+		// lets Close() interrupt the pending Read()
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		events:  make(chan WatchEvent),
+		errors:  make(chan error),
+		mutex:   &sync.Mutex{},
+		watches: make(map[int32]string),
+		paths:   make(map[string]int32),
+		files:   make(map[string]bool),
+	}
+
+	_, err = iw.addRecursive(dir)
+	if err != nil {
+		iw.file.Close()
+		return nil, err
+	}
+
+	go iw.read()
+
+	return iw, nil
+}
+
+// addRecursive adds a watch for the directory and all of its
+// subdirectories, returns the files found in them.
+func (iw *inotifyWatcher) addRecursive(dir string) ([]string, error) {
+	files := make([]string, 0)
+
+	err := fp.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// the directory might have been removed in the meantime
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		relPath, _ := fp.Rel(iw.root, path)
+		if !d.IsDir() {
+			iw.setKnown(path, true)
+			if iw.filter.Allows(relPath) {
+				files = append(files, path)
+			}
+			return nil
+		}
+		if path != iw.root && iw.filter.IsIgnored(relPath) {
+			return fs.SkipDir
+		}
+
+		wd, err := syscall.InotifyAddWatch(iw.fd, path, inotifyMask)
+		if err != nil {
+			return fmt.Errorf("failed to watch directory(%s): %w", path, err)
+		}
+
+		iw.mutex.Lock()
+		iw.watches[int32(wd)] = path
+		iw.paths[path] = int32(wd)
+		iw.mutex.Unlock()
+		return nil
+	})
+
+	return files, err
+}
+
+// removeRecursive forgets the watches of the directory and its
+// subdirectories. Used when the directory is moved, in which case
+// the kernel keeps the watches but they point to the old paths.
+func (iw *inotifyWatcher) removeRecursive(dir string) {
+	iw.mutex.Lock()
+	defer iw.mutex.Unlock()
+
+	prefix := dir + string(fp.Separator)
+	for path, wd := range iw.paths {
+		if path == dir || strings.HasPrefix(path, prefix) {
+			syscall.InotifyRmWatch(iw.fd, uint32(wd))
+			delete(iw.paths, path)
+			delete(iw.watches, wd)
+		}
+	}
+	for path := range iw.files {
+		if strings.HasPrefix(path, prefix) {
+			delete(iw.files, path)
+		}
+	}
+}
+
+// setKnown records whether the file exists in the watched tree,
+// returns whether it was known before.
+func (iw *inotifyWatcher) setKnown(path string, exists bool) bool {
+	iw.mutex.Lock()
+	defer iw.mutex.Unlock()
+	known := iw.files[path]
+	if exists {
+		iw.files[path] = true
+	} else {
+		delete(iw.files, path)
+	}
+	return known
+}
+
+func (iw *inotifyWatcher) read() {
+	defer close(iw.events)
+
+	buff := make([]byte, (syscall.SizeofInotifyEvent+syscall.NAME_MAX+1)*64)
+
+	for {
+		n, err := iw.file.Read(buff)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				iw.errors <- err
+			}
+			return
+		}
+
+		iw.process(buff[:n])
+	}
+}
+
+type pendingMove struct {
+	path  string
+	isDir bool
+}
+
+func (iw *inotifyWatcher) process(buff []byte) {
+	// moves are reported as a pair of MOVED_FROM and MOVED_TO events
+	// sharing a cookie, a MOVED_FROM without a matching MOVED_TO means
+	// the file was moved out of the watched tree
+	moves := make(map[uint32]pendingMove)
+
+	offset := 0
+	for offset+syscall.SizeofInotifyEvent <= len(buff) {
+		raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buff[offset]))
+		nameStart := offset + syscall.SizeofInotifyEvent
+		nameEnd := nameStart + int(raw.Len)
+		offset = nameEnd
+
+		if raw.Mask&syscall.IN_Q_OVERFLOW != 0 {
+			iw.errors <- fmt.Errorf("inotify event queue overflowed, some changes were not reported")
+			continue
+		}
+
+		iw.mutex.Lock()
+		dir, ok := iw.watches[raw.Wd]
+		iw.mutex.Unlock()
+		if !ok {
+			continue
+		}
+
+		if raw.Mask&(syscall.IN_DELETE_SELF|syscall.IN_IGNORED) != 0 {
+			iw.mutex.Lock()
+			delete(iw.watches, raw.Wd)
+			if iw.paths[dir] == raw.Wd {
+				delete(iw.paths, dir)
+			}
+			iw.mutex.Unlock()
+			continue
+		}
+
+		name := strings.TrimRight(string(buff[nameStart:nameEnd]), "\x00")
+		path := fp.Join(dir, name)
+		isDir := raw.Mask&syscall.IN_ISDIR != 0
+
+		switch {
+		case raw.Mask&syscall.IN_CREATE != 0:
+			if isDir {
+				iw.addDir(path)
+			} else {
+				iw.setKnown(path, true)
+				iw.emit(WatchEvent{Op: HmrCreated, Path: path})
+			}
+		case raw.Mask&(syscall.IN_CLOSE_WRITE|syscall.IN_ATTRIB) != 0:
+			if !isDir {
+				iw.setKnown(path, true)
+				iw.emit(WatchEvent{Op: HmrChanged, Path: path})
+			}
+		case raw.Mask&syscall.IN_DELETE != 0:
+			if !isDir {
+				iw.setKnown(path, false)
+				iw.emit(WatchEvent{Op: HmrDeleted, Path: path})
+			}
+		case raw.Mask&syscall.IN_MOVED_FROM != 0:
+			if !isDir {
+				iw.setKnown(path, false)
+			}
+			moves[raw.Cookie] = pendingMove{path, isDir}
+		case raw.Mask&syscall.IN_MOVED_TO != 0:
+			from, paired := moves[raw.Cookie]
+			delete(moves, raw.Cookie)
+
+			if isDir {
+				if paired {
+					iw.renameDir(from.path, path)
+				} else {
+					iw.addDir(path)
+				}
+				continue
+			}
+
+			known := iw.setKnown(path, true)
+			switch {
+			case known:
+				// the file was replaced, e.g. an editor saved it by
+				// writing a temporary file and renaming it over it
+				if paired {
+					iw.emit(WatchEvent{Op: HmrDeleted, Path: from.path})
+				}
+				iw.emit(WatchEvent{Op: HmrChanged, Path: path})
+			case paired:
+				iw.emit(WatchEvent{Op: HmrRenamed, Path: path, OldPath: from.path})
+			default:
+				iw.emit(WatchEvent{Op: HmrCreated, Path: path})
+			}
+		}
+	}
+
+	for _, move := range moves {
+		if move.isDir {
+			for _, file := range iw.knownFiles(move.path) {
+				iw.emit(WatchEvent{Op: HmrDeleted, Path: file})
+			}
+			iw.removeRecursive(move.path)
+		} else {
+			iw.emit(WatchEvent{Op: HmrDeleted, Path: move.path})
+		}
+	}
+}
+
+func (iw *inotifyWatcher) emit(event WatchEvent) {
+	if event, ok := filterEvent(iw.filter, iw.root, event); ok {
+		iw.events <- event
+	}
+}
+
+// addDir starts watching a directory that appeared in the tree, and
+// reports the files that are already in it, since these could have
+// been created before the watch was added.
+func (iw *inotifyWatcher) addDir(dir string) {
+	files, err := iw.addRecursive(dir)
+	if err != nil {
+		iw.errors <- err
+	}
+	for _, file := range files {
+		iw.emit(WatchEvent{Op: HmrCreated, Path: file})
+	}
+}
+
+// renameDir moves the watches of a directory renamed within the tree
+// to the new path, the files in it are reported as renamed, and the
+// ones that appeared in the meantime as created.
+func (iw *inotifyWatcher) renameDir(oldDir string, newDir string) {
+	oldFiles := iw.knownFiles(oldDir)
+	iw.removeRecursive(oldDir)
+
+	files, err := iw.addRecursive(newDir)
+	if err != nil {
+		iw.errors <- err
+	}
+
+	renamed := map[string]bool{}
+	for _, oldPath := range oldFiles {
+		path := newDir + strings.TrimPrefix(oldPath, oldDir)
+		renamed[path] = true
+		iw.emit(WatchEvent{Op: HmrRenamed, Path: path, OldPath: oldPath})
+	}
+	for _, file := range files {
+		if !renamed[file] {
+			iw.emit(WatchEvent{Op: HmrCreated, Path: file})
+		}
+	}
+}
+
+// knownFiles returns the known files within the directory.
+func (iw *inotifyWatcher) knownFiles(dir string) []string {
+	iw.mutex.Lock()
+	defer iw.mutex.Unlock()
+
+	prefix := dir + string(fp.Separator)
+	files := []string{}
+	for path := range iw.files {
+		if strings.HasPrefix(path, prefix) {
+			files = append(files, path)
+		}
+	}
+	slices.Sort(files)
+	return files
+}
+
+func (iw *inotifyWatcher) Events() <-chan WatchEvent {
+	return iw.events
+}
+
+func (iw *inotifyWatcher) Errors() <-chan error {
+	return iw.errors
+}
+
+func (iw *inotifyWatcher) Close() {
+	iw.file.Close()
+}
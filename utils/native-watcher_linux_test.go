@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"os"
+	fp "path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// collectEvents returns the events reported until none arrive for a
+// while, with the paths relative to the root, sorted.
+func collectEvents(t *testing.T, w FsWatcher, root string) []WatchEvent {
+	events := []WatchEvent{}
+	rel := func(path string) string {
+		if path == "" {
+			return ""
+		}
+		relPath, _ := fp.Rel(root, path)
+		return fp.ToSlash(relPath)
+	}
+	for {
+		select {
+		case ev := <-w.Events():
+			events = append(events, WatchEvent{Op: ev.Op, Path: rel(ev.Path), OldPath: rel(ev.OldPath)})
+		case err := <-w.Errors():
+			t.Fatal(err)
+		case <-time.After(200 * time.Millisecond):
+			slices.SortFunc(events, func(a, b WatchEvent) int {
+				return strings.Compare(a.Op+a.Path, b.Op+b.Path)
+			})
+			return events
+		}
+	}
+}
+
+func TestNativeWatcher(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(root, outside string) error
+		want   []WatchEvent
+	}{
+		{
+			name: "file changed",
+			change: func(root, _ string) error {
+				return os.WriteFile(fp.Join(root, "a.txt"), []byte("changed"), 0644)
+			},
+			want: []WatchEvent{{Op: HmrChanged, Path: "a.txt"}},
+		},
+		{
+			name: "file renamed",
+			change: func(root, _ string) error {
+				return os.Rename(fp.Join(root, "a.txt"), fp.Join(root, "b.txt"))
+			},
+			want: []WatchEvent{{Op: HmrRenamed, Path: "b.txt", OldPath: "a.txt"}},
+		},
+		{
+			name: "file replaced by a rename",
+			change: func(root, _ string) error {
+				tmp := fp.Join(root, "dir", ".x.txt.tmp")
+				if err := os.WriteFile(tmp, []byte("saved"), 0644); err != nil {
+					return err
+				}
+				return os.Rename(tmp, fp.Join(root, "dir", "x.txt"))
+			},
+			want: []WatchEvent{
+				{Op: HmrChanged, Path: "dir/.x.txt.tmp"},
+				{Op: HmrChanged, Path: "dir/x.txt"},
+				{Op: HmrCreated, Path: "dir/.x.txt.tmp"},
+				{Op: HmrDeleted, Path: "dir/.x.txt.tmp"},
+			},
+		},
+		{
+			name: "directory renamed",
+			change: func(root, _ string) error {
+				return os.Rename(fp.Join(root, "dir"), fp.Join(root, "renamed"))
+			},
+			want: []WatchEvent{
+				{Op: HmrRenamed, Path: "renamed/sub/y.txt", OldPath: "dir/sub/y.txt"},
+				{Op: HmrRenamed, Path: "renamed/x.txt", OldPath: "dir/x.txt"},
+			},
+		},
+		{
+			name: "directory moved out",
+			change: func(root, outside string) error {
+				return os.Rename(fp.Join(root, "dir"), fp.Join(outside, "dir"))
+			},
+			want: []WatchEvent{
+				{Op: HmrDeleted, Path: "dir/sub/y.txt"},
+				{Op: HmrDeleted, Path: "dir/x.txt"},
+			},
+		},
+		{
+			name: "directory moved in",
+			change: func(root, outside string) error {
+				os.MkdirAll(fp.Join(outside, "new"), 0755)
+				os.WriteFile(fp.Join(outside, "new", "z.txt"), nil, 0644)
+				return os.Rename(fp.Join(outside, "new"), fp.Join(root, "new"))
+			},
+			want: []WatchEvent{{Op: HmrCreated, Path: "new/z.txt"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := fp.Join(t.TempDir(), "root")
+			outside := t.TempDir()
+			os.MkdirAll(fp.Join(root, "dir", "sub"), 0755)
+			os.WriteFile(fp.Join(root, "a.txt"), nil, 0644)
+			os.WriteFile(fp.Join(root, "dir", "x.txt"), nil, 0644)
+			os.WriteFile(fp.Join(root, "dir", "sub", "y.txt"), nil, 0644)
+
+			w, err := createNativeWatcher(root, 0, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+
+			if err := tt.change(root, outside); err != nil {
+				t.Fatal(err)
+			}
+			if got := collectEvents(t, w, root); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNativeWatcherRenamedDirectoryIsWatched(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(fp.Join(root, "dir"), 0755)
+
+	w, err := createNativeWatcher(root, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	os.Rename(fp.Join(root, "dir"), fp.Join(root, "renamed"))
+	collectEvents(t, w, root)
+
+	os.WriteFile(fp.Join(root, "renamed", "a.txt"), nil, 0644)
+	want := []WatchEvent{{Op: HmrChanged, Path: "renamed/a.txt"}, {Op: HmrCreated, Path: "renamed/a.txt"}}
+	if got := collectEvents(t, w, root); !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %+v, want %+v", got, want)
+	}
+}
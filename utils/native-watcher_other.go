@@ -0,0 +1,10 @@
+//go:build !linux
+
+package utils
+
+import "time"
+
+// there's no native backend for this platform yet
+func createNativeWatcher(dir string, pollInterval time.Duration, filter *WatchFilter) (FsWatcher, error) {
+	return createPollWatcher(dir, pollInterval, filter)
+}
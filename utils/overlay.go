@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	fp "path/filepath"
+	"strings"
+)
+
+// Layer is one of the filesystems merged by an Overlay.
+type Layer struct {
+	FS fs.FS
+	// path of the directory or archive the files are read from,
+	// empty for the filesystems provided by the app, e.g. embed.FS
+	Source string
+	// set for the directories on the disk, the changes of which
+	// can be watched
+	Dir string
+}
+
+// DirLayer returns the layer of the files in the directory.
+func DirLayer(dir string) Layer {
+	if abs, err := fp.Abs(dir); err == nil {
+		dir = abs
+	}
+	dir = fp.Clean(dir)
+	return Layer{FS: os.DirFS(dir), Source: dir, Dir: dir}
+}
+
+// OpenLayer returns the layer of the files in the directory, or in
+// the archive, under the path.
+func OpenLayer(source string) (Layer, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return Layer{}, err
+	}
+	if info.IsDir() {
+		return DirLayer(source), nil
+	}
+	if !IsArchive(source) {
+		return Layer{}, fmt.Errorf("not a directory or a supported archive: %s", source)
+	}
+
+	fsys, err := OpenArchive(source)
+	if err != nil {
+		return Layer{}, err
+	}
+	if abs, err := fp.Abs(source); err == nil {
+		source = abs
+	}
+	return Layer{FS: fsys, Source: source}, nil
+}
+
+// Overlay merges an ordered list of filesystems into one namespace,
+// a file is taken from the first layer it exists in, the files with
+// the same path in the following layers are shadowed.
+//
+// The Overlay itself is a filesystem opening the files of the merged
+// view, the directories are not merged, the first layer having the
+// directory is used.
+type Overlay struct {
+	Layers []Layer
+}
+
+func CreateOverlay(layers ...Layer) *Overlay {
+	return &Overlay{Layers: layers}
+}
+
+// cleanRelPath prevents the relative paths from pointing
+// outside of the layers.
+func cleanRelPath(relPath string) string {
+	return path.Clean("/" + relPath)[1:]
+}
+
+// Find returns the information about the file under the relative path
+// in the first layer it exists in, starting at the given index, and the
+// index of that layer, or -1 if there's no such file.
+func (o *Overlay) Find(relPath string, from int) (fs.FileInfo, int) {
+	relPath = cleanRelPath(relPath)
+	if relPath == "" {
+		return nil, -1
+	}
+	for i := from; i < len(o.Layers); i++ {
+		info, err := fs.Stat(o.Layers[i].FS, relPath)
+		if err == nil && !info.IsDir() {
+			return info, i
+		}
+	}
+	return nil, -1
+}
+
+// ReadFile reads the file under the relative path from the layer.
+func (o *Overlay) ReadFile(layer int, relPath string) ([]byte, fs.FileInfo, error) {
+	file, err := o.Layers[layer].FS.Open(cleanRelPath(relPath))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return content, info, nil
+}
+
+// Location returns a human readable location of the file under the
+// relative path in the layer, its path on the disk if there is one.
+func (o *Overlay) Location(layer int, relPath string) string {
+	l := o.Layers[layer]
+	if l.Dir != "" {
+		return fp.Join(l.Dir, fp.FromSlash(relPath))
+	}
+	if l.Source != "" {
+		return l.Source + "/" + relPath
+	}
+	return relPath
+}
+
+// LayerOf returns the index of the layer of the directory containing
+// the path on the disk and the path relative to it, or -1 if it's
+// outside of all of them. The innermost directory is picked when
+// they are nested.
+func (o *Overlay) LayerOf(filepath string) (int, string) {
+	layer := -1
+	relPath := ""
+	for i, l := range o.Layers {
+		if l.Dir == "" {
+			continue
+		}
+		rel, err := fp.Rel(l.Dir, filepath)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(fp.Separator)) {
+			continue
+		}
+		if layer == -1 || len(l.Dir) > len(o.Layers[layer].Dir) {
+			layer = i
+			relPath = fp.ToSlash(rel)
+		}
+	}
+	return layer, relPath
+}
+
+func (o *Overlay) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if _, layer := o.Find(name, 0); layer != -1 {
+		return o.Layers[layer].FS.Open(name)
+	}
+	for _, l := range o.Layers {
+		if file, err := l.FS.Open(name); err == nil {
+			return file, nil
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// Walk calls the callback with the relative path of each file of the
+// merged namespace and the index of the layer it's taken from.
+func (o *Overlay) Walk(callback func(relPath string, layer int) error) error {
+	seen := map[string]bool{}
+	for i, l := range o.Layers {
+		err := fs.WalkDir(l.FS, ".", func(relPath string, entry fs.DirEntry, err error) error {
+			// the unreadable directories are skipped
+			if err != nil || entry.IsDir() || seen[relPath] {
+				return nil
+			}
+			seen[relPath] = true
+			return callback(relPath, i)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"os"
+	fp "path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestOverlayFind(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(fp.Join(dir, "js"), 0755)
+	os.WriteFile(fp.Join(dir, "index.html"), []byte("disk"), 0644)
+	os.WriteFile(fp.Join(dir, "js", "app.js"), []byte("disk"), 0644)
+
+	mem := CreateMemFS()
+	mem.AddFile("index.html", []byte("mem"), time.Now())
+	mem.AddFile("js/lib.js", []byte("mem"), time.Now())
+	mem.AddFile("js/app.js/readme.txt", []byte("mem"), time.Now())
+
+	overlay := CreateOverlay(DirLayer(dir), Layer{FS: mem})
+
+	tests := []struct {
+		relPath string
+		from    int
+		want    int
+	}{
+		{relPath: "index.html", want: 0},
+		{relPath: "index.html", from: 1, want: 1},
+		{relPath: "js/lib.js", want: 1},
+		{relPath: "/js/../js/lib.js", want: 1},
+		{relPath: "../index.html", want: 0},
+		{relPath: "js", want: -1},
+		{relPath: "", want: -1},
+		{relPath: "missing.js", want: -1},
+	}
+	for _, tt := range tests {
+		if _, got := overlay.Find(tt.relPath, tt.from); got != tt.want {
+			t.Errorf("Find(%q, %d) = %d, want %d", tt.relPath, tt.from, got, tt.want)
+		}
+	}
+
+	content, _, err := overlay.ReadFile(1, "index.html")
+	if err != nil || string(content) != "mem" {
+		t.Errorf("ReadFile(1, index.html) = %q, %v", content, err)
+	}
+	if got := overlay.Location(0, "js/app.js"); got != fp.Join(dir, "js", "app.js") {
+		t.Errorf("Location(0) = %q", got)
+	}
+	if got := overlay.Location(1, "js/lib.js"); got != "js/lib.js" {
+		t.Errorf("Location(1) = %q", got)
+	}
+}
+
+func TestOverlayWalk(t *testing.T) {
+	first := fstest.MapFS{
+		"index.html": {Data: []byte("first")},
+		"js/app.js":  {Data: []byte("first")},
+	}
+	second := fstest.MapFS{
+		"index.html": {Data: []byte("second")},
+		"js/lib.js":  {Data: []byte("second")},
+	}
+	overlay := CreateOverlay(Layer{FS: first}, Layer{FS: second})
+
+	got := map[string]int{}
+	overlay.Walk(func(relPath string, layer int) error {
+		got[relPath] = layer
+		return nil
+	})
+	want := map[string]int{"index.html": 0, "js/app.js": 0, "js/lib.js": 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk() = %v, want %v", got, want)
+	}
+
+	if err := fstest.TestFS(overlay, "index.html", "js/app.js"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOverlayLayerOf(t *testing.T) {
+	root := t.TempDir()
+	public := fp.Join(root, "public")
+	nested := fp.Join(root, "public", "vendor")
+	overlay := CreateOverlay(
+		DirLayer(public),
+		Layer{FS: fstest.MapFS{}, Source: "site.zip"},
+		DirLayer(nested),
+	)
+
+	tests := []struct {
+		path      string
+		wantLayer int
+		wantRel   string
+	}{
+		{fp.Join(public, "index.html"), 0, "index.html"},
+		{fp.Join(nested, "lib", "a.js"), 2, "lib/a.js"},
+		{fp.Join(root, "public-old", "a.js"), -1, ""},
+		{fp.Join(root, "a.js"), -1, ""},
+	}
+	for _, tt := range tests {
+		layer, rel := overlay.LayerOf(tt.path)
+		if layer != tt.wantLayer || rel != tt.wantRel {
+			t.Errorf("LayerOf(%q) = %d, %q, want %d, %q", tt.path, layer, rel, tt.wantLayer, tt.wantRel)
+		}
+	}
+}
@@ -10,6 +10,8 @@ import (
 type ParsedArgs struct {
 	Input       string
 	NamedParams *Map[string, string]
+	// all values of each param, for params that can be repeated
+	ParamLists *Map[string, []string]
 }
 
 func (args *ParsedArgs) HasParam(paramName string) bool {
@@ -24,6 +26,14 @@ func (args *ParsedArgs) GetParam(paramName string, defaultValue string) string {
 	return defaultValue
 }
 
+// GetParamList returns all the values given for a repeatable param.
+func (args *ParsedArgs) GetParamList(paramName string) []string {
+	if v, ok := args.ParamLists.Get(paramName); ok {
+		return v
+	}
+	return []string{}
+}
+
 func (args *ParsedArgs) GetParamInt(paramName string, defaultValue int) int {
 	if v, ok := args.NamedParams.Get(paramName); ok {
 		if i, err := strconv.Atoi(v); err == nil {
@@ -64,6 +74,7 @@ func ParseArgs(args []string, boolArgs BoolArgsList) ParsedArgs {
 	results := ParsedArgs{
 		Input:       "",
 		NamedParams: NewMap(map[string]string{}),
+		ParamLists:  NewMap(map[string][]string{}),
 	}
 
 	for i := 0; i < len(args); i += 1 {
@@ -71,7 +82,10 @@ func ParseArgs(args []string, boolArgs BoolArgsList) ParsedArgs {
 		if strings.HasPrefix(arg, "-") {
 			vIdx := i + 1
 			if !boolArgs.isOne(arg) && vIdx < len(args) && !strings.HasPrefix(args[vIdx], "-") {
-				results.NamedParams.Set(removePrefix(arg), args[vIdx])
+				name := removePrefix(arg)
+				list, _ := results.ParamLists.Get(name)
+				results.NamedParams.Set(name, args[vIdx])
+				results.ParamLists.Set(name, append(list, args[vIdx]))
 				i += 1
 			} else {
 				results.NamedParams.Set(removePrefix(arg), "")
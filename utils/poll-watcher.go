@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"io/fs"
+	fp "path/filepath"
+	"time"
+
+	"github.com/radovskyb/watcher"
+)
+
+type pollWatcher struct {
+	w      *watcher.Watcher
+	root   string
+	filter *WatchFilter
+	events chan WatchEvent
+}
+
+func createPollWatcher(dir string, interval time.Duration, filter *WatchFilter) (FsWatcher, error) {
+	w := watcher.New()
+
+	// the poller can only ignore exact paths, so the directories
+	// matching the ignore patterns at the time of the start are
+	// excluded from scanning, and the events are filtered as well
+	if filter != nil && len(filter.Ignore) > 0 {
+		fp.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() || path == dir {
+				return nil
+			}
+			relPath, _ := fp.Rel(dir, path)
+			if filter.IsIgnored(relPath) {
+				w.Ignore(path)
+				return fs.SkipDir
+			}
+			return nil
+		})
+	}
+
+	err := w.AddRecursive(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	pw := &pollWatcher{
+		w:      w,
+		root:   dir,
+		filter: filter,
+		events: make(chan WatchEvent),
+	}
+
+	go pw.forward()
+	go func() {
+		err := w.Start(interval)
+		if err != nil {
+			w.Error <- err
+		}
+	}()
+
+	return pw, nil
+}
+
+func (pw *pollWatcher) forward() {
+	defer close(pw.events)
+
+	for {
+		select {
+		case event := <-pw.w.Event:
+			if event.IsDir() {
+				continue
+			}
+			var ev WatchEvent
+			switch event.Op {
+			case watcher.Write:
+				ev = WatchEvent{Op: HmrChanged, Path: event.Path}
+			case watcher.Create:
+				ev = WatchEvent{Op: HmrCreated, Path: event.Path}
+			case watcher.Remove:
+				ev = WatchEvent{Op: HmrDeleted, Path: event.Path}
+			case watcher.Rename, watcher.Move:
+				ev = WatchEvent{Op: HmrRenamed, Path: event.Path, OldPath: event.OldPath}
+			default:
+				continue
+			}
+			if ev, ok := filterEvent(pw.filter, pw.root, ev); ok {
+				pw.events <- ev
+			}
+		case <-pw.w.Closed:
+			return
+		}
+	}
+}
+
+func (pw *pollWatcher) Events() <-chan WatchEvent {
+	return pw.events
+}
+
+func (pw *pollWatcher) Errors() <-chan error {
+	return pw.w.Error
+}
+
+func (pw *pollWatcher) Close() {
+	pw.w.Close()
+}
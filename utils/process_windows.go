@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// ShellCommand creates a command running the given command line in the
+// system shell.
+func ShellCommand(command string) *exec.Cmd {
+	return exec.Command("cmd", "/C", command)
+}
+
+func KillProcessTree(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+}
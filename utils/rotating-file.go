@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// RotatingFile is an append-only file writer that moves the current file
+// aside once it grows past the max size, keeping at most `maxBackups`
+// older copies (file.1, file.2, ...).
+type RotatingFile struct {
+	path       string
+	maxSize    uint64
+	maxBackups int
+
+	file  *os.File
+	size  uint64
+	mutex *sync.Mutex
+}
+
+func OpenRotatingFile(path string, maxSize uint64, maxBackups int) (*RotatingFile, error) {
+	rf := &RotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+		mutex:      &sync.Mutex{},
+	}
+
+	err := rf.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return rf, nil
+}
+
+func (rf *RotatingFile) open() error {
+	file, err := os.OpenFile(rf.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	rf.file = file
+	rf.size = uint64(info.Size())
+	return nil
+}
+
+func (rf *RotatingFile) rotate() error {
+	err := rf.file.Close()
+	if err != nil {
+		return err
+	}
+
+	if rf.maxBackups > 0 {
+		for i := rf.maxBackups - 1; i > 0; i-- {
+			from := fmt.Sprintf("%s.%d", rf.path, i)
+			if FileExists(from) {
+				os.Rename(from, fmt.Sprintf("%s.%d", rf.path, i+1))
+			}
+		}
+		err = os.Rename(rf.path, rf.path+".1")
+	} else {
+		err = os.Remove(rf.path)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return rf.open()
+}
+
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+uint64(len(p)) > rf.maxSize {
+		err := rf.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += uint64(n)
+	return n, err
+}
+
+func (rf *RotatingFile) Close() error {
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+	return rf.file.Close()
+}
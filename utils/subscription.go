@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"slices"
+	"sync"
+)
+
+// Subscription receives the messages broadcast to all the HMR clients,
+// for consumers running in the same process, e.g. an embedding app
+// or a test harness. Messages targeted to specific clients are not
+// delivered to the subscriptions.
+type Subscription struct {
+	// C is closed when the subscription is closed, either explicitly,
+	// when the controller is closed, or when the subscriber falls more
+	// than clientQueueSize messages behind
+	C <-chan *HmrMessage
+
+	ch         chan *HmrMessage
+	controller *WsController
+	closeOnce  *sync.Once
+}
+
+// Subscribe returns a new subscription to the broadcast messages.
+func (controller *WsController) Subscribe() *Subscription {
+	ch := make(chan *HmrMessage, clientQueueSize)
+	sub := &Subscription{
+		C:          ch,
+		ch:         ch,
+		controller: controller,
+		closeOnce:  &sync.Once{},
+	}
+
+	controller.mutex.Lock()
+	controller.subscriptions = append(controller.subscriptions, sub)
+	controller.mutex.Unlock()
+	return sub
+}
+
+// OnMessage calls the callback with each broadcast message, on
+// a separate goroutine, until the returned function is called.
+func (controller *WsController) OnMessage(callback func(msg *HmrMessage)) (unsubscribe func()) {
+	sub := controller.Subscribe()
+	go func() {
+		for msg := range sub.C {
+			callback(msg)
+		}
+	}()
+	return sub.Close
+}
+
+// Close stops the subscription and closes its channel.
+func (sub *Subscription) Close() {
+	sub.controller.mutex.Lock()
+	defer sub.controller.mutex.Unlock()
+	sub.closeLocked()
+}
+
+// closeLocked closes the subscription, the controller mutex must be held.
+func (sub *Subscription) closeLocked() {
+	sub.closeOnce.Do(func() {
+		sub.controller.subscriptions = slices.DeleteFunc(sub.controller.subscriptions, func(s *Subscription) bool {
+			return s == sub
+		})
+		close(sub.ch)
+	})
+}
+
+// publish passes a copy of the message to each subscription without
+// blocking, the controller mutex must be held.
+func (controller *WsController) publish(msg *HmrMessage) {
+	for _, sub := range slices.Clone(controller.subscriptions) {
+		select {
+		case sub.ch <- msg.versioned():
+		default:
+			sub.closeLocked()
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package utils
+
+import "sync"
+
+// TailBuffer is a writer that keeps only the last `size` bytes
+// written to it.
+type TailBuffer struct {
+	size  int
+	data  []byte
+	mutex *sync.Mutex
+}
+
+func CreateTailBuffer(size int) *TailBuffer {
+	return &TailBuffer{
+		size:  size,
+		data:  make([]byte, 0, size),
+		mutex: &sync.Mutex{},
+	}
+}
+
+func (b *TailBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.data = append(b.data, p...)
+	if len(b.data) > b.size {
+		b.data = append(b.data[:0], b.data[len(b.data)-b.size:]...)
+	}
+	return len(p), nil
+}
+
+func (b *TailBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return string(b.data)
+}
@@ -1,45 +1,288 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+const (
+	TransportWebSocket   = "websocket"
+	TransportEventStream = "sse"
+)
+
+type WsClient struct {
+	ID uint64 `json:"id"`
+	// TransportWebSocket or TransportEventStream
+	Transport   string    `json:"transport"`
+	RemoteAddr  string    `json:"remoteAddr"`
+	UserAgent   string    `json:"userAgent"`
+	ConnectedAt time.Time `json:"connectedAt"`
+	// version of the HMR protocol used by the client, 0 for the legacy one
+	Protocol int `json:"protocol"`
+	// page the client is on and the groups it belongs to,
+	// as sent by the client in the `hello` message
+	Page   string   `json:"page"`
+	Groups []string `json:"groups"`
+	// path patterns of the files the client wants to receive
+	// the events for, all events are sent if empty
+	Subscriptions []string `json:"subscriptions"`
+
+	conn   *websocket.Conn
+	stream *eventStream
+
+	queue      chan [][]byte
+	done       chan struct{}
+	writerDone chan struct{}
+	closeOnce  *sync.Once
+}
+
+// Wants reports whether the file event should be sent to the client.
+func (client *WsClient) Wants(msg *HmrMessage) bool {
+	if !msg.IsFileEvent() {
+		return true
+	}
+	if msg.Type == HmrDependencyChanged && client.Page != "" && msg.Page != client.Page {
+		return false
+	}
+	if len(client.Subscriptions) == 0 {
+		return true
+	}
+
+	paths := []string{msg.FullPath()}
+	if msg.Type == HmrRenamed {
+		paths = append(paths, (&HmrMessage{Root: msg.Root, Path: msg.OldPath}).FullPath())
+	}
+	for _, pattern := range client.Subscriptions {
+		for _, p := range paths {
+			if MatchGlob(pattern, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filter returns the message with the events the client is not
+// interested in left out, or nil if there's nothing left to send.
+func (client *WsClient) filter(msg *HmrMessage) *HmrMessage {
+	if msg.Type != HmrBatch {
+		if client.Wants(msg) {
+			return msg
+		}
+		return nil
+	}
+
+	events := make([]*HmrMessage, 0, len(msg.Events))
+	for _, ev := range msg.Events {
+		if client.Wants(ev) {
+			events = append(events, ev)
+		}
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	if len(events) == len(msg.Events) {
+		return msg
+	}
+
+	filtered := *msg
+	filtered.Events = events
+	return &filtered
+}
+
+// ClientTarget selects the clients a message is sent to. A client is
+// selected if it matches any of the given ids, pages or groups.
+type ClientTarget struct {
+	IDs    []uint64 `json:"ids,omitempty"`
+	Pages  []string `json:"pages,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+}
+
+func (t *ClientTarget) Matches(client *WsClient) bool {
+	if slices.Contains(t.IDs, client.ID) || slices.Contains(t.Pages, client.Page) {
+		return true
+	}
+	for _, group := range client.Groups {
+		if slices.Contains(t.Groups, group) {
+			return true
+		}
+	}
+	return false
+}
+
 type WsController struct {
-	connections []*websocket.Conn
-	mutex       *sync.Mutex
+	// random id sent to the clients on connect, lets them
+	// tell when the server was restarted
+	BootId string
+
+	connections   []*WsClient
+	subscriptions []*Subscription
+	mutex         *sync.Mutex
+	lastId        uint64
+	history       *messageHistory
 }
 
 func CreateWsController() *WsController {
+	b := make([]byte, 8)
+	rand.Read(b)
+
 	return &WsController{
-		connections: make([]*websocket.Conn, 0),
+		BootId:      hex.EncodeToString(b),
+		connections: make([]*WsClient, 0),
 		mutex:       &sync.Mutex{},
+		history:     createMessageHistory(256),
 	}
 }
 
-func (controller *WsController) AddConnection(conn *websocket.Conn) {
-	controller.mutex.Lock()
-	controller.connections = append(controller.connections, conn)
-	controller.mutex.Unlock()
+func (controller *WsController) AddConnection(conn *websocket.Conn, req *http.Request) *WsClient {
+	client := &WsClient{
+		Transport:   TransportWebSocket,
+		RemoteAddr:  req.RemoteAddr,
+		UserAgent:   req.UserAgent(),
+		ConnectedAt: time.Now(),
+		Protocol:    requestedProtocol(req),
+		conn:        conn,
+		closeOnce:   &sync.Once{},
+	}
+	client.startWriter()
+
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		return nil
+	})
+
+	controller.register(client, req)
 
 	go func() {
-		defer conn.Close()
+		defer client.close()
 		defer controller.RemoveConnection(conn)
 
 		for {
-			_, _, err := conn.ReadMessage()
+			_, data, err := conn.ReadMessage()
 			if err != nil {
 				break
 			}
+			controller.handleClientMessage(client, data)
 		}
 	}()
+
+	return client
+}
+
+// register assigns an id to the client and adds it to the connected
+// clients, after sending it the `connected` message and the messages
+// it missed, if it's reconnecting to the same server instance.
+func (controller *WsController) register(client *WsClient, req *http.Request) {
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+
+	controller.lastId++
+	client.ID = controller.lastId
+
+	// queued at once, the replayed messages could
+	// exceed the size of the queue otherwise
+	frames := make([][]byte, 0)
+
+	connected := &HmrMessage{
+		Type:     HmrConnected,
+		BootId:   controller.BootId,
+		ClientId: client.ID,
+	}
+	if client.stream != nil {
+		frames = append(frames, encodeEvent(0, HmrConnected, connected.JSON()))
+	} else if client.Protocol >= 1 {
+		frames = append(frames, client.encode(0, connected)...)
+	}
+
+	query := req.URL.Query()
+	bootId := query.Get("bootId")
+	if lastId, ok := lastEventId(req); ok && (bootId == "" || bootId == controller.BootId) {
+		for _, entry := range controller.history.since(lastId) {
+			if entry.target != nil && !entry.target.Matches(client) {
+				continue
+			}
+			if msg := client.filter(entry.msg); msg != nil {
+				frames = append(frames, client.encode(entry.id, msg)...)
+			}
+		}
+	}
+
+	if len(frames) > 0 {
+		client.enqueue(frames)
+	}
+	controller.connections = append(controller.connections, client)
+}
+
+// HandleClientMessage applies a message sent by the client with the
+// given id, for the clients that cannot send messages over their
+// connection. Returns false if there's no such client.
+func (controller *WsController) HandleClientMessage(id uint64, data []byte) bool {
+	controller.mutex.Lock()
+	idx := slices.IndexFunc(controller.connections, func(c *WsClient) bool {
+		return c.ID == id
+	})
+	var client *WsClient
+	if idx != -1 {
+		client = controller.connections[idx]
+	}
+	controller.mutex.Unlock()
+
+	if client == nil {
+		return false
+	}
+	controller.handleClientMessage(client, data)
+	return true
+}
+
+func (controller *WsController) handleClientMessage(client *WsClient, data []byte) {
+	msg := HmrClientMessage{}
+	if json.Unmarshal(data, &msg) != nil {
+		return
+	}
+
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+
+	// the slices are replaced rather than modified, since
+	// the snapshots returned by Clients() share them
+	switch msg.Type {
+	case HmrClientHello:
+		client.Page = msg.Page
+		client.Groups = msg.Groups
+	case HmrClientSubscribe:
+		subs := slices.Clone(client.Subscriptions)
+		for _, pattern := range msg.Patterns {
+			if !slices.Contains(subs, pattern) {
+				subs = append(subs, pattern)
+			}
+		}
+		client.Subscriptions = subs
+	case HmrClientUnsubscribe:
+		client.Subscriptions = slices.DeleteFunc(slices.Clone(client.Subscriptions), func(p string) bool {
+			return slices.Contains(msg.Patterns, p)
+		})
+	}
 }
 
 func (controller *WsController) RemoveConnection(conn *websocket.Conn) {
+	controller.removeClient(func(c *WsClient) bool {
+		return c.conn == conn
+	})
+}
+
+func (controller *WsController) removeClient(match func(c *WsClient) bool) {
 	controller.mutex.Lock()
 	for i, c := range controller.connections {
-		if c == conn {
+		if match(c) {
 			controller.connections = append(
 				controller.connections[:i],
 				controller.connections[i+1:]...,
@@ -48,14 +291,103 @@ func (controller *WsController) RemoveConnection(conn *websocket.Conn) {
 		}
 	}
 	controller.mutex.Unlock()
+}
+
+func requestedProtocol(req *http.Request) int {
+	v, err := strconv.Atoi(req.URL.Query().Get("v"))
+	if err != nil || v < 0 {
+		return 0
+	}
+	if v > HmrProtocolVersion {
+		return HmrProtocolVersion
+	}
+	return v
+}
+
+// Send sends the message to a single client.
+func (controller *WsController) Send(client *WsClient, msg *HmrMessage) {
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
 
+	if msg = client.filter(msg); msg != nil {
+		client.enqueue(client.encode(0, msg))
+	}
+}
+
+// SendToAll sends the message to every client, leaving out
+// the file events the client did not subscribe to.
+func (controller *WsController) SendToAll(msg *HmrMessage) {
+	controller.SendTo(nil, msg)
 }
 
-func (controller *WsController) SendToAll(strMsg string) {
-	msg := []byte(strMsg)
+// SendTo sends the message to the clients selected by the target,
+// or all clients if the target is nil. Returns the number of
+// clients the message was queued for, the clients that fell too
+// far behind are disconnected.
+func (controller *WsController) SendTo(target *ClientTarget, msg *HmrMessage) int {
 	controller.mutex.Lock()
-	for _, conn := range controller.connections {
-		conn.WriteMessage(websocket.TextMessage, msg)
+	defer controller.mutex.Unlock()
+
+	// the message is shared by the writers of the clients and the
+	// subscriptions, the caller's copy is left untouched
+	msg = msg.versioned()
+
+	// kept for the clients that reconnect and ask for the missed messages
+	id := controller.history.add(target, msg)
+	msg.Id = id
+
+	if target == nil {
+		controller.publish(msg)
+	}
+
+	count := 0
+	for _, c := range controller.connections {
+		if target != nil && !target.Matches(c) {
+			continue
+		}
+		if filtered := c.filter(msg); filtered != nil && c.enqueue(c.encode(id, filtered)) {
+			count++
+		}
+	}
+	return count
+}
+
+func (controller *WsController) Count() int {
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+	return len(controller.connections)
+}
+
+// Clients returns a snapshot of the currently connected clients.
+func (controller *WsController) Clients() []WsClient {
+	controller.mutex.Lock()
+	defer controller.mutex.Unlock()
+
+	clients := make([]WsClient, len(controller.connections))
+	for i, c := range controller.connections {
+		clients[i] = *c
+	}
+	return clients
+}
+
+// CloseAll sends a close frame to every connected client
+// and closes the connections and the subscriptions.
+func (controller *WsController) CloseAll() {
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	deadline := time.Now().Add(time.Second)
+
+	controller.mutex.Lock()
+	clients := controller.connections
+	controller.connections = make([]*WsClient, 0)
+	for _, sub := range slices.Clone(controller.subscriptions) {
+		sub.closeLocked()
 	}
 	controller.mutex.Unlock()
+
+	for _, c := range clients {
+		if c.conn != nil {
+			c.conn.WriteControl(websocket.CloseMessage, msg, deadline)
+		}
+		c.close()
+	}
 }
@@ -0,0 +1,259 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// serveHmr starts a server passing the WebSocket connections to the
+// controller, and returns its `ws://` URL.
+func serveHmr(t *testing.T, controller *WsController) string {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		controller.AddConnection(conn, r)
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(controller.CloseAll)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// waitFor fails the test if the condition isn't met within a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// readMessages reads the messages received by the client until
+// none arrive for a while.
+func readMessages(t *testing.T, conn *websocket.Conn) []HmrMessage {
+	messages := []HmrMessage{}
+	for {
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		msg := HmrMessage{}
+		if err := conn.ReadJSON(&msg); err != nil {
+			if netErr, ok := err.(interface{ Timeout() bool }); !ok || !netErr.Timeout() {
+				t.Fatal(err)
+			}
+			return messages
+		}
+		messages = append(messages, msg)
+	}
+}
+
+func TestWsControllerReplaysMissedMessages(t *testing.T) {
+	type received struct {
+		Type string
+		Id   uint64
+		Path string
+	}
+
+	tests := []struct {
+		name  string
+		query func(bootId string) string
+		want  []received
+	}{
+		{
+			name:  "new client",
+			query: func(string) string { return "v=1" },
+			want:  []received{{Type: HmrConnected}},
+		},
+		{
+			name:  "all missed",
+			query: func(bootId string) string { return "v=1&lastEventId=0&bootId=" + bootId },
+			want: []received{
+				{Type: HmrConnected},
+				{Type: HmrChanged, Id: 1, Path: "/a.js"},
+				{Type: HmrChanged, Id: 3, Path: "/c.css"},
+			},
+		},
+		{
+			name:  "some missed",
+			query: func(bootId string) string { return "v=1&lastEventId=2&bootId=" + bootId },
+			want: []received{
+				{Type: HmrConnected},
+				{Type: HmrChanged, Id: 3, Path: "/c.css"},
+			},
+		},
+		{
+			name:  "none missed",
+			query: func(bootId string) string { return "v=1&lastEventId=3&bootId=" + bootId },
+			want:  []received{{Type: HmrConnected}},
+		},
+		{
+			name:  "without the boot id",
+			query: func(string) string { return "v=1&lastEventId=2" },
+			want: []received{
+				{Type: HmrConnected},
+				{Type: HmrChanged, Id: 3, Path: "/c.css"},
+			},
+		},
+		{
+			name:  "restarted server",
+			query: func(string) string { return "v=1&lastEventId=0&bootId=other" },
+			want:  []received{{Type: HmrConnected}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := CreateWsController()
+			url := serveHmr(t, controller)
+
+			controller.SendToAll(&HmrMessage{Type: HmrChanged, Path: "/a.js"})
+			// sent to the clients of another page only
+			controller.SendTo(&ClientTarget{Pages: []string{"/other.html"}}, &HmrMessage{Type: HmrChanged, Path: "/b.js"})
+			controller.SendToAll(&HmrMessage{Type: HmrChanged, Path: "/c.css"})
+
+			conn, _, err := websocket.DefaultDialer.Dial(url+"?"+tt.query(controller.BootId), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			got := []received{}
+			for _, msg := range readMessages(t, conn) {
+				got = append(got, received{msg.Type, msg.Id, msg.Path})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("messages = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWsControllerBroadcastsConcurrently(t *testing.T) {
+	controller := CreateWsController()
+	url := serveHmr(t, controller)
+
+	conns := make([]*websocket.Conn, 4)
+	for i := range conns {
+		conn, _, err := websocket.DefaultDialer.Dial(url+"?v=1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns[i] = conn
+	}
+	waitFor(t, "the clients", func() bool { return controller.Count() == len(conns) })
+
+	// fewer messages than fit in the queue of a client,
+	// none of them is disconnected however slow they read
+	const senders, perSender = 4, 50
+	wg := sync.WaitGroup{}
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perSender; j++ {
+				controller.SendToAll(&HmrMessage{Type: HmrChanged, Path: fmt.Sprintf("/%d.js", j)})
+				controller.Clients()
+			}
+		}()
+	}
+
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn *websocket.Conn) {
+			defer wg.Done()
+			lastId := uint64(0)
+			count := 0
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			for count < senders*perSender {
+				msg := HmrMessage{}
+				if err := conn.ReadJSON(&msg); err != nil {
+					t.Errorf("read after %d messages: %s", count, err)
+					return
+				}
+				if msg.Type == HmrConnected {
+					continue
+				}
+				if msg.Id <= lastId {
+					t.Errorf("message %d received after %d", msg.Id, lastId)
+				}
+				lastId = msg.Id
+				count++
+			}
+		}(conn)
+	}
+	wg.Wait()
+
+	if n := controller.Count(); n != len(conns) {
+		t.Errorf("Count() = %d, want %d", n, len(conns))
+	}
+}
+
+// blockingWriter is a response writer whose writes block until
+// it's released, like the connection of a client that stopped
+// reading.
+type blockingWriter struct {
+	header  http.Header
+	writing chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (w *blockingWriter) Header() http.Header { return w.header }
+
+func (w *blockingWriter) WriteHeader(int) {}
+
+func (w *blockingWriter) Write(data []byte) (int, error) {
+	w.once.Do(func() { close(w.writing) })
+	<-w.release
+	return len(data), nil
+}
+
+func (w *blockingWriter) Flush() {}
+
+func TestWsControllerClosesSlowClient(t *testing.T) {
+	controller := CreateWsController()
+	w := &blockingWriter{
+		header:  http.Header{},
+		writing: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		controller.AddEventStream(w, httptest.NewRequest("GET", "/", nil), nil)
+	}()
+
+	// the writer is stuck on the `connected` event
+	<-w.writing
+
+	for i := 0; i < clientQueueSize; i++ {
+		if n := controller.SendTo(nil, &HmrMessage{Type: HmrChanged, Path: "/a.js"}); n != 1 {
+			t.Fatalf("SendTo() #%d = %d, want 1", i, n)
+		}
+	}
+	if n := controller.SendTo(nil, &HmrMessage{Type: HmrChanged, Path: "/a.js"}); n != 0 {
+		t.Errorf("SendTo() with a full queue = %d, want 0", n)
+	}
+
+	close(w.release)
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("the slow client was not closed")
+	}
+	if n := controller.Count(); n != 0 {
+		t.Errorf("Count() = %d after closing the slow client", n)
+	}
+}